@@ -4,6 +4,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time" // <-- ADICIONAR IMPORT
 
 	"github.com/joho/godotenv"
@@ -14,6 +16,39 @@ type Config struct {
 	DatabaseURL       string
 	JWTSecret         string
 	JWTExpirationTime time.Duration
+	// Ativa o dígito verificador (ISO 7064 MOD 37,36) no esquema GAIOLA criado na primeira execução.
+	// Depois disso, o dígito é configurado por esquema em TrackingIDScheme.
+	TrackingCheckDigit bool
+	// Durante a migração, aceita IDs antigos sem dígito verificador que já existam na base de dados.
+	TrackingAcceptLegacy bool
+	// Idade a partir da qual etiquetas PENDENTE nunca utilizadas são expiradas (0 desativa).
+	LabelExpirationAge time.Duration
+	// Intervalo entre execuções da expiração automática de etiquetas.
+	LabelExpirationInterval time.Duration
+	// Expressão cron da tarefa que grava os snapshots de backlog por buffer.
+	BacklogSnapshotSchedule string
+	// Tempo durante o qual os snapshots de backlog são mantidos.
+	BacklogSnapshotRetention time.Duration
+	// Limite de permanência por buffer, usado na contagem "acima do SLA" (ex: "RTS=4h,EHA=2h").
+	DwellSLAThresholds map[string]time.Duration
+	// Expressão cron da tarefa que avalia as regras de SLA e abre ou escala alertas.
+	SLAEvaluationSchedule string
+	// Expressão cron da tarefa que avalia as regras de alerta configuráveis.
+	AlertRulesSchedule string
+	// Máximo de ligações simultâneas ao fluxo público /public/stream (por instância).
+	PublicStreamMaxConnections int
+	// Máximo de pedidos de ligação ao fluxo público por IP e por minuto (0 desativa).
+	PublicStreamRateLimit int
+	// Origens do frontend (FRONTEND_URL, separadas por vírgula), usadas no CORS e na verificação do WebSocket.
+	FrontendOrigins []string
+	// Máximo de ligações WebSocket simultâneas por instância e por utilizador em todas as instâncias (0 desativa).
+	WSMaxConnections        int
+	WSMaxConnectionsPerUser int
+	// Máximo de pedidos de ligação WebSocket por IP e por minuto (0 desativa).
+	WSUpgradeRateLimit int
+	// Proxies (IPs ou CIDR, separados por vírgula) cujo X-Forwarded-For é usado para obter o IP
+	// do cliente. Sem proxies confiáveis o IP é o da ligação TCP e o cabeçalho é ignorado.
+	TrustedProxies []string
 }
 
 var AppConfig *Config
@@ -33,8 +68,110 @@ func LoadConfig() {
 	}
 
 	AppConfig = &Config{
-		DatabaseURL:       os.Getenv("DATABASE_URL"),
-		JWTSecret:         os.Getenv("JWT_SECRET"),
-		JWTExpirationTime: duration, // <-- USAR O VALOR CARREGADO
+		DatabaseURL:          os.Getenv("DATABASE_URL"),
+		JWTSecret:            os.Getenv("JWT_SECRET"),
+		JWTExpirationTime:    duration, // <-- USAR O VALOR CARREGADO
+		TrackingCheckDigit:   getEnvBool("TRACKING_ID_CHECK_DIGIT", false),
+		TrackingAcceptLegacy: getEnvBool("TRACKING_ID_ACCEPT_LEGACY", true),
+
+		LabelExpirationAge:      getEnvDuration("LABEL_EXPIRATION_AGE", 30*24*time.Hour),
+		LabelExpirationInterval: getEnvDuration("LABEL_EXPIRATION_INTERVAL", time.Hour),
+
+		BacklogSnapshotSchedule:  getEnvString("BACKLOG_SNAPSHOT_SCHEDULE", "*/5 * * * *"),
+		BacklogSnapshotRetention: getEnvDuration("BACKLOG_SNAPSHOT_RETENTION", 90*24*time.Hour),
+
+		DwellSLAThresholds:    getEnvDurationMap("DWELL_SLA_THRESHOLDS"),
+		SLAEvaluationSchedule: getEnvString("SLA_EVALUATION_SCHEDULE", "* * * * *"),
+		AlertRulesSchedule:    getEnvString("ALERT_RULES_SCHEDULE", "* * * * *"),
+
+		PublicStreamMaxConnections: getEnvInt("PUBLIC_STREAM_MAX_CONNECTIONS", 100),
+		PublicStreamRateLimit:      getEnvInt("PUBLIC_STREAM_RATE_LIMIT", 30),
+
+		FrontendOrigins:         getEnvList("FRONTEND_URL", "http://localhost:5173"),
+		WSMaxConnections:        getEnvInt("WS_MAX_CONNECTIONS", 1000),
+		WSMaxConnectionsPerUser: getEnvInt("WS_MAX_CONNECTIONS_PER_USER", 5),
+		WSUpgradeRateLimit:      getEnvInt("WS_UPGRADE_RATE_LIMIT", 30),
+		TrustedProxies:          getEnvList("TRUSTED_PROXIES", ""),
+	}
+}
+
+// getEnvDuration lê uma duração ("90m", "720h"...), usando o padrão se estiver ausente ou inválida.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s value %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvString lê uma variável de texto, usando o padrão se estiver ausente.
+func getEnvString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvList lê uma lista separada por vírgulas, usando o padrão se estiver ausente.
+// As barras finais são retiradas ("http://site/" -> "http://site").
+func getEnvList(key string, fallback string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnvString(key, fallback), ",") {
+		if item = strings.TrimRight(strings.TrimSpace(item), "/"); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvDurationMap lê uma lista "CHAVE=duração" separada por vírgulas (ex: "RTS=4h,EHA=2h").
+// Entradas inválidas são ignoradas.
+func getEnvDurationMap(key string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if !found || err != nil {
+			log.Printf("Invalid %s entry %q, ignoring", key, pair)
+			continue
+		}
+		result[strings.ToUpper(strings.TrimSpace(name))] = parsed
+	}
+	return result
+}
+
+// getEnvInt lê uma variável inteira, usando o padrão se estiver ausente ou inválida.
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s value %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvBool lê uma variável booleana ("true", "1", "false"...), usando o padrão se estiver ausente ou inválida.
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s value %q, using default %v", key, value, fallback)
+		return fallback
 	}
+	return parsed
 }
\ No newline at end of file
@@ -0,0 +1,162 @@
+// backend/controllers/alertRuleController.go
+package controllers
+
+import (
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alertRuleBody é o corpo aceite na criação e edição de regras de alerta.
+type alertRuleBody struct {
+	Name            string   `json:"name" binding:"required"`
+	Metric          string   `json:"metric" binding:"required"`
+	Buffer          string   `json:"buffer"`
+	Comparator      string   `json:"comparator" binding:"required"`
+	Threshold       *float64 `json:"threshold" binding:"required"`
+	WindowMinutes   int      `json:"windowMinutes"`
+	CooldownMinutes int      `json:"cooldownMinutes"`
+	Severity        string   `json:"severity"`
+	Active          *bool    `json:"active"`
+}
+
+// toRule normaliza e valida o corpo (severidade AVISO por omissão).
+func (b alertRuleBody) toRule() (models.AlertRule, error) {
+	severity := strings.ToUpper(strings.TrimSpace(b.Severity))
+	if severity == "" {
+		severity = "AVISO"
+	}
+	active := true
+	if b.Active != nil {
+		active = *b.Active
+	}
+	rule := models.AlertRule{
+		Name:            strings.TrimSpace(b.Name),
+		Metric:          strings.TrimSpace(b.Metric),
+		Buffer:          strings.ToUpper(strings.TrimSpace(b.Buffer)),
+		Comparator:      strings.TrimSpace(b.Comparator),
+		Threshold:       *b.Threshold,
+		WindowMinutes:   b.WindowMinutes,
+		CooldownMinutes: b.CooldownMinutes,
+		Severity:        severity,
+		Active:          active,
+	}
+	return rule, services.ValidateAlertRule(rule)
+}
+
+// GetAlertRules lista as regras de alerta com o estado da última avaliação.
+func GetAlertRules(c *gin.Context) {
+	var rules []models.AlertRule
+	if err := initializers.DB.Order("name asc").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar as regras de alerta."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// GetAlertMetrics lista as métricas que podem ser usadas nas regras de alerta.
+func GetAlertMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": services.AlertMetrics})
+}
+
+// GetAlertRuleEvents devolve o histórico de disparos e normalizações (mais recentes primeiro).
+// Aceita ?ruleId= e ?limit= (máximo 500).
+func GetAlertRuleEvents(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		limit = 100
+	}
+	query := initializers.DB.Order("occurred_at desc").Limit(limit)
+	if ruleID := c.Query("ruleId"); ruleID != "" {
+		query = query.Where("alert_rule_id = ?", ruleID)
+	}
+
+	var events []models.AlertRuleEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar o histórico de alertas."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
+
+// CreateAlertRule cria uma regra de alerta, avaliada pela tarefa "avaliar-regras-alerta".
+func CreateAlertRule(c *gin.Context) {
+	var body alertRuleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome, métrica, comparador e limite são obrigatórios."})
+		return
+	}
+	rule, err := body.toRule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := initializers.DB.Create(&rule).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma regra de alerta com este nome."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar a regra de alerta."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de alerta criada com sucesso.", "data": rule})
+}
+
+// UpdateAlertRule altera uma regra de alerta. A regra volta ao estado OK, para ser
+// reavaliada com a nova configuração.
+func UpdateAlertRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := initializers.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra de alerta não encontrada."})
+		return
+	}
+
+	var body alertRuleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome, métrica, comparador e limite são obrigatórios."})
+		return
+	}
+	updated, err := body.toRule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updated.State = services.AlertRuleStateOK
+
+	// Select garante que valores zero (limite 0, "Active: false"...) também são gravados.
+	err = initializers.DB.Model(&rule).
+		Select("Name", "Metric", "Buffer", "Comparator", "Threshold", "WindowMinutes", "CooldownMinutes", "Severity", "Active", "State", "PendingSince").
+		Updates(updated).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma regra de alerta com este nome."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar a regra de alerta."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de alerta atualizada com sucesso."})
+}
+
+// DeleteAlertRule remove definitivamente uma regra de alerta, libertando o nome.
+// O histórico em AlertRuleEvent é mantido.
+func DeleteAlertRule(c *gin.Context) {
+	result := initializers.DB.Unscoped().Delete(&models.AlertRule{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover a regra de alerta."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra de alerta não encontrada."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de alerta removida com sucesso."})
+}
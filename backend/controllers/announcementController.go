@@ -0,0 +1,40 @@
+// backend/controllers/announcementController.go
+package controllers
+
+import (
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fifo-system/backend/websocket"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SendAnnouncement envia um aviso em tempo real aos clientes subscritos ao tópico
+// "announcements" ({"message": "..."}, até 500 caracteres).
+func SendAnnouncement(c *gin.Context) {
+	var body struct {
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A mensagem do aviso é obrigatória."})
+		return
+	}
+	message := strings.TrimSpace(body.Message)
+	if message == "" || len([]rune(message)) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A mensagem do aviso deve ter entre 1 e 500 caracteres."})
+		return
+	}
+
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+	if err := services.CreateAuditLog(initializers.DB, user, "AVISO_ENVIADO", message); err != nil {
+		log.Printf("Erro ao registar aviso no log de auditoria: %v", err)
+	}
+
+	websocket.H.Announce(websocket.AnnouncementMessage{Message: message, From: user.FullName, SentAt: services.GetBrasiliaTime()})
+	c.JSON(http.StatusOK, gin.H{"message": "Aviso enviado."})
+}
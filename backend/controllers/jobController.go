@@ -0,0 +1,55 @@
+// backend/controllers/jobController.go
+package controllers
+
+import (
+	"errors"
+	"fifo-system/backend/scheduler"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetScheduledJobs lista as tarefas agendadas com o estado da última execução.
+func GetScheduledJobs(c *gin.Context) {
+	jobs, err := scheduler.S.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar as tarefas agendadas."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// TriggerScheduledJob executa uma tarefa de imediato, em segundo plano.
+func TriggerScheduledJob(c *gin.Context) {
+	if err := scheduler.S.Trigger(c.Param("name")); err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Execução da tarefa iniciada."})
+}
+
+// PauseScheduledJob suspende as execuções agendadas de uma tarefa em todas as instâncias.
+func PauseScheduledJob(c *gin.Context) {
+	if err := scheduler.S.SetPaused(c.Param("name"), true); err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tarefa pausada com sucesso."})
+}
+
+// ResumeScheduledJob retoma as execuções agendadas de uma tarefa.
+func ResumeScheduledJob(c *gin.Context) {
+	if err := scheduler.S.SetPaused(c.Param("name"), false); err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tarefa retomada com sucesso."})
+}
+
+func respondJobError(c *gin.Context, err error) {
+	if errors.Is(err, scheduler.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tarefa não encontrada."})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao atualizar a tarefa."})
+}
@@ -0,0 +1,211 @@
+// backend/controllers/labelBatchController.go
+package controllers
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// labelBatchSummary é a representação de um lote na listagem, com o estado das suas etiquetas.
+type labelBatchSummary struct {
+	ID                uint      `json:"id"`
+	CreatedAt         time.Time `json:"createdAt"`
+	CreatedByUsername string    `json:"createdByUsername"`
+	CreatedByFullname string    `json:"createdByFullname"`
+	Reason            string    `json:"reason"`
+	Quantity          int       `json:"quantity"`
+	Pending           int64     `json:"pending"` // Ainda não utilizadas (PENDENTE)
+	Used              int64     `json:"used"`    // Já deram entrada na fila pelo menos uma vez
+	Voided            int64     `json:"voided"`  // Anuladas
+	Expired           int64     `json:"expired"` // Expiradas por não terem sido utilizadas
+}
+
+// parseBatchID lê o parâmetro :id da rota e confirma que o lote existe.
+func parseBatchID(c *gin.Context) (*models.LabelBatch, bool) {
+	batchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de lote inválido."})
+		return nil, false
+	}
+
+	var batch models.LabelBatch
+	if err := initializers.DB.First(&batch, uint(batchID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Lote não encontrado."})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar o lote."})
+		}
+		return nil, false
+	}
+	return &batch, true
+}
+
+// GetLabelBatches lista os lotes de etiquetas gerados, do mais recente para o mais antigo.
+func GetLabelBatches(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var batches []models.LabelBatch
+	if err := initializers.DB.Order("created_at desc").Limit(limit).Find(&batches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os lotes de etiquetas."})
+		return
+	}
+
+	batchIDs := make([]uint, len(batches))
+	for i, b := range batches {
+		batchIDs[i] = b.ID
+	}
+
+	type batchCounts struct {
+		LabelBatchID uint
+		Total        int64
+		Pending      int64
+		Voided       int64
+		Expired      int64
+	}
+	var counts []batchCounts
+	if len(batchIDs) > 0 {
+		err := initializers.DB.Model(&models.Package{}).Unscoped().
+			Select(`label_batch_id,
+				COUNT(*) AS total,
+				COUNT(*) FILTER (WHERE buffer = 'PENDENTE' AND deleted_at IS NULL) AS pending,
+				COUNT(*) FILTER (WHERE buffer = 'ANULADO') AS voided,
+				COUNT(*) FILTER (WHERE buffer = 'EXPIRADO') AS expired`).
+			Where("label_batch_id IN ?", batchIDs).
+			Group("label_batch_id").
+			Scan(&counts).Error
+		if err != nil {
+			log.Printf("Erro ao contar etiquetas por lote: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os lotes de etiquetas."})
+			return
+		}
+	}
+	countsByBatch := make(map[uint]batchCounts, len(counts))
+	for _, bc := range counts {
+		countsByBatch[bc.LabelBatchID] = bc
+	}
+
+	summaries := make([]labelBatchSummary, 0, len(batches))
+	for _, b := range batches {
+		bc := countsByBatch[b.ID]
+		summaries = append(summaries, labelBatchSummary{
+			ID:                b.ID,
+			CreatedAt:         b.CreatedAt,
+			CreatedByUsername: b.CreatedByUsername,
+			CreatedByFullname: b.CreatedByFullname,
+			Reason:            b.Reason,
+			Quantity:          b.Quantity,
+			Pending:           bc.Pending,
+			Used:              bc.Total - bc.Pending - bc.Voided - bc.Expired,
+			Voided:            bc.Voided,
+			Expired:           bc.Expired,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": summaries})
+}
+
+// ReprintLabelBatch devolve todos os códigos de um lote que ainda podem ser impressos
+// (ou seja, todos exceto os anulados), no mesmo formato de FindQRCodeData.
+func ReprintLabelBatch(c *gin.Context) {
+	batch, ok := parseBatchID(c)
+	if !ok {
+		return
+	}
+
+	var trackingIDs []string
+	err := initializers.DB.Model(&models.Package{}).Unscoped().
+		Where("label_batch_id = ? AND buffer <> ?", batch.ID, "ANULADO").
+		Order("tracking_id asc").
+		Pluck("tracking_id", &trackingIDs).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar os códigos do lote."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": trackingIDs})
+}
+
+// VoidLabelBatch anula etiquetas ainda não utilizadas de um lote, para que uma folha
+// perdida não possa ser lida mais tarde. Sem "trackingIds", anula todas as pendentes do lote.
+func VoidLabelBatch(c *gin.Context) {
+	batch, ok := parseBatchID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		TrackingIDs []string `json:"trackingIds"`
+		Reason      string   `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "O motivo da anulação é obrigatório."})
+		return
+	}
+	reason := strings.TrimSpace(body.Reason)
+
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	var voidedIDs []string
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		now := services.GetBrasiliaTime()
+		// Apenas etiquetas PENDENTE (nunca utilizadas) podem ser anuladas. A condição vai no
+		// próprio UPDATE, para que uma etiqueta que dê entrada entretanto não seja anulada.
+		// Soft delete junto com o Buffer "ANULADO": as consultas da fila ativa ignoram-nas
+		// automaticamente e PackageEntry recusa-as explicitamente.
+		updates := map[string]interface{}{
+			"Buffer":     "ANULADO",
+			"VoidedAt":   now,
+			"VoidReason": reason,
+			"DeletedAt":  now,
+		}
+		var voided []models.Package
+		query := tx.Model(&voided).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "tracking_id"}}}).
+			Where("label_batch_id = ? AND buffer = ?", batch.ID, "PENDENTE")
+		if len(body.TrackingIDs) > 0 {
+			query = query.Where("tracking_id IN ?", body.TrackingIDs)
+		}
+		if err := query.Updates(updates).Error; err != nil {
+			return fmt.Errorf("falha ao anular etiquetas: %w", err)
+		}
+		if len(voided) == 0 {
+			return errors.New("nenhuma etiqueta pendente para anular neste lote")
+		}
+		for _, pkg := range voided {
+			voidedIDs = append(voidedIDs, pkg.TrackingID)
+		}
+		sort.Strings(voidedIDs)
+
+		logDetails := fmt.Sprintf("%d etiquetas do lote #%d foram anuladas. Motivo: %s", len(voidedIDs), batch.ID, reason)
+		return services.CreateAuditLog(tx, user, "ANULACAO_ETIQUETAS", logDetails)
+	})
+
+	if err != nil {
+		if strings.Contains(err.Error(), "nenhuma etiqueta pendente") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Nenhuma etiqueta pendente para anular neste lote."})
+		} else {
+			log.Printf("Erro na transação de VoidLabelBatch: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao anular as etiquetas."})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Etiquetas anuladas com sucesso.", "data": voidedIDs})
+}
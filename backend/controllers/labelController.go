@@ -0,0 +1,116 @@
+// backend/controllers/labelController.go
+package controllers
+
+import (
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLabelsPerRender limita o tamanho de cada pedido de renderização.
+const maxLabelsPerRender = 500
+
+// labelRenderRequest é o corpo aceite pelos endpoints de etiquetas.
+type labelRenderRequest struct {
+	TrackingIDs []string `json:"trackingIds" binding:"required"`
+	Format      string   `json:"format"`   // "pdf" (padrão), "png" ou "zpl"
+	WidthMM     float64  `json:"widthMm"`  // Largura da etiqueta (padrão 50 mm)
+	HeightMM    float64  `json:"heightMm"` // Altura da etiqueta (padrão 50 mm)
+	DPI         int      `json:"dpi"`      // Resolução para PNG/ZPL (padrão 203)
+	ShowCaption bool     `json:"showCaption"`
+	Caption     string   `json:"caption"`
+}
+
+// validateLabelRequest valida o pedido já lido e devolve as opções normalizadas.
+// Códigos anulados são recusados, tal como em FindQRCodeData.
+func validateLabelRequest(c *gin.Context, body *labelRenderRequest) (services.LabelOptions, bool) {
+	if len(body.TrackingIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs é obrigatória."})
+		return services.LabelOptions{}, false
+	}
+	if len(body.TrackingIDs) > maxLabelsPerRender {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("No máximo %d etiquetas por pedido.", maxLabelsPerRender)})
+		return services.LabelOptions{}, false
+	}
+
+	opts := services.LabelOptions{
+		WidthMM:     body.WidthMM,
+		HeightMM:    body.HeightMM,
+		DPI:         body.DPI,
+		ShowCaption: body.ShowCaption,
+		Caption:     body.Caption,
+	}
+	if err := opts.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return opts, false
+	}
+
+	var voided []string
+	if err := initializers.DB.Model(&models.Package{}).Unscoped().
+		Where("tracking_id IN ? AND buffer = ?", body.TrackingIDs, "ANULADO").
+		Pluck("tracking_id", &voided).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao verificar os códigos."})
+		return opts, false
+	}
+	if len(voided) > 0 {
+		c.JSON(http.StatusGone, gin.H{"error": "Os seguintes códigos foram anulados e não podem ser impressos: " + strings.Join(voided, ", ")})
+		return opts, false
+	}
+
+	return opts, true
+}
+
+// RenderLabels devolve as etiquetas prontas a imprimir: uma folha A4 em PDF, os QR Codes
+// em PNG (um ficheiro, ou um ZIP quando há vários IDs) ou ZPL para impressoras térmicas.
+func RenderLabels(c *gin.Context) {
+	var body labelRenderRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs é obrigatória."})
+		return
+	}
+	opts, ok := validateLabelRequest(c, &body)
+	if !ok {
+		return
+	}
+
+	var (
+		data        []byte
+		err         error
+		contentType string
+		filename    string
+	)
+	switch strings.ToLower(body.Format) {
+	case "", "pdf":
+		data, err = services.RenderLabelsPDF(body.TrackingIDs, opts)
+		contentType, filename = "application/pdf", "etiquetas.pdf"
+	case "png":
+		if len(body.TrackingIDs) == 1 {
+			data, err = services.RenderLabelPNG(body.TrackingIDs[0], opts)
+			contentType, filename = "image/png", body.TrackingIDs[0]+".png"
+		} else {
+			data, err = services.RenderLabelsPNGZip(body.TrackingIDs, opts)
+			contentType, filename = "application/zip", "etiquetas.zip"
+		}
+	case "zpl":
+		data, err = services.RenderLabelsZPL(body.TrackingIDs, opts)
+		contentType, filename = "application/zpl", "etiquetas.zpl"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato inválido. Use 'pdf', 'png' ou 'zpl'."})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Erro ao renderizar etiquetas: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao gerar as etiquetas."})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, data)
+}
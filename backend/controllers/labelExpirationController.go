@@ -0,0 +1,106 @@
+// backend/controllers/labelExpirationController.go
+package controllers
+
+import (
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetLabelExpirationRuns lista os relatórios das últimas execuções da expiração de etiquetas.
+func GetLabelExpirationRuns(c *gin.Context) {
+	var runs []models.LabelExpirationRun
+	if err := initializers.DB.Order("created_at desc").Limit(50).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os relatórios de expiração."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": runs})
+}
+
+// RunLabelExpiration executa a expiração de imediato. A idade pode ser indicada em ?maxAge=
+// (ex: "72h"); por omissão usa LABEL_EXPIRATION_AGE.
+func RunLabelExpiration(c *gin.Context) {
+	maxAge := config.AppConfig.LabelExpirationAge
+	if value := c.Query("maxAge"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idade inválida. Use, por exemplo, '72h' (mínimo 1h)."})
+			return
+		}
+		maxAge = parsed
+	}
+	if maxAge <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A expiração de etiquetas está desativada."})
+		return
+	}
+
+	userInterface, _ := c.Get("user")
+	run, err := services.ExpireStaleLabels(maxAge, userInterface.(models.User))
+	if err != nil {
+		log.Printf("Erro na expiração manual de etiquetas: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao expirar etiquetas."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d etiquetas expiradas.", run.ExpiredCount), "data": run})
+}
+
+// ReactivateLabels devolve etiquetas EXPIRADO ao estado PENDENTE, para poderem voltar a dar entrada.
+// A data de reativação reinicia a contagem para a expiração seguinte.
+func ReactivateLabels(c *gin.Context) {
+	var body struct {
+		TrackingIDs []string `json:"trackingIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || len(body.TrackingIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs é obrigatória."})
+		return
+	}
+
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	var reactivated []string
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Package{}).Unscoped().
+			Where("tracking_id IN ? AND buffer = ?", body.TrackingIDs, "EXPIRADO").
+			Pluck("tracking_id", &reactivated).Error; err != nil {
+			return fmt.Errorf("erro ao buscar etiquetas expiradas: %w", err)
+		}
+		if len(reactivated) == 0 {
+			return nil
+		}
+
+		updates := map[string]interface{}{
+			"Buffer":        "PENDENTE",
+			"ExpiredAt":     nil,
+			"DeletedAt":     nil,
+			"ReactivatedAt": services.GetBrasiliaTime(),
+		}
+		if err := tx.Unscoped().Model(&models.Package{}).Where("tracking_id IN ?", reactivated).Updates(updates).Error; err != nil {
+			return fmt.Errorf("falha ao reativar etiquetas: %w", err)
+		}
+
+		logDetails := fmt.Sprintf("%d etiquetas expiradas foram reativadas: %s", len(reactivated), strings.Join(reactivated, ", "))
+		return services.CreateAuditLog(tx, user, "REATIVACAO_ETIQUETAS", logDetails)
+	})
+
+	if err != nil {
+		log.Printf("Erro na transação de ReactivateLabels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao reativar as etiquetas."})
+		return
+	}
+	if len(reactivated) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nenhuma etiqueta expirada encontrada entre os IDs indicados."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Etiquetas reativadas com sucesso.", "data": reactivated})
+}
@@ -0,0 +1,175 @@
+// backend/controllers/metricsController.go
+package controllers
+
+import (
+	"fifo-system/backend/services"
+	"fifo-system/backend/websocket"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxMetricsRange  = 90 * 24 * time.Hour
+	maxMetricsPoints = 2000
+	targetPoints     = 300 // Usado para escolher o intervalo quando não é indicado
+)
+
+// metricsIntervals são os intervalos sugeridos automaticamente, do mais fino para o mais largo.
+var metricsIntervals = []time.Duration{
+	5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// parseMetricsRange lê ?from, ?to (RFC3339) e ?interval (ex: "15m", "1h").
+// Por omissão devolve as últimas 24 horas; sem intervalo usa defaultInterval ou,
+// se for zero, um intervalo que dá cerca de 300 pontos.
+func parseMetricsRange(c *gin.Context, defaultInterval time.Duration) (time.Time, time.Time, time.Duration, bool) {
+	from, to, ok := parseMetricsPeriod(c)
+	if !ok {
+		return from, to, 0, false
+	}
+
+	var interval time.Duration
+	if value := c.Query("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < time.Minute {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Intervalo inválido. Use, por exemplo, '15m' ou '1h' (mínimo 1m)."})
+			return from, to, 0, false
+		}
+		interval = parsed
+	} else if defaultInterval > 0 {
+		interval = defaultInterval
+	} else {
+		interval = metricsIntervals[len(metricsIntervals)-1]
+		for _, candidate := range metricsIntervals {
+			if to.Sub(from)/candidate <= targetPoints {
+				interval = candidate
+				break
+			}
+		}
+	}
+	if to.Sub(from)/interval > maxMetricsPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Intervalo demasiado pequeno para o período pedido."})
+		return from, to, 0, false
+	}
+
+	return from, to, interval, true
+}
+
+// parseMetricsPeriod lê apenas ?from e ?to, para as métricas que não são agrupadas por intervalo.
+func parseMetricsPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	to := services.GetBrasiliaTime()
+	from := to.Add(-24 * time.Hour)
+
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro 'to' inválido. Use o formato RFC3339 (ex: 2025-01-31T14:00:00-03:00)."})
+			return from, to, false
+		}
+		to = parsed
+		from = to.Add(-24 * time.Hour)
+	}
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro 'from' inválido. Use o formato RFC3339 (ex: 2025-01-31T14:00:00-03:00)."})
+			return from, to, false
+		}
+		from = parsed
+	}
+	if !from.Before(to) || to.Sub(from) > maxMetricsRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Período inválido: 'from' deve ser anterior a 'to' e o período não pode exceder 90 dias."})
+		return from, to, false
+	}
+
+	return from, to, true
+}
+
+// GetBacklogMetrics devolve a série temporal de contagem, valor e tempo médio por buffer,
+// calculada a partir dos snapshots de backlog (GET /api/metrics/backlog?from&to&interval).
+func GetBacklogMetrics(c *gin.Context) {
+	from, to, interval, ok := parseMetricsRange(c, 0)
+	if !ok {
+		return
+	}
+
+	series, err := services.GetBacklogSeries(from, to, interval)
+	if err != nil {
+		log.Printf("Erro ao buscar série de backlog: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar o histórico do backlog."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"interval": interval.String(),
+		"series":   series,
+	})
+}
+
+// GetThroughputMetrics devolve as entradas, saídas e movimentações por intervalo (por omissão
+// 1 hora), agrupadas por ?groupBy=buffer|rua|operator|none e filtráveis por ?buffer, ?rua,
+// ?username e ?scheme. Calculado a partir dos PackageEvent.
+func GetThroughputMetrics(c *gin.Context) {
+	from, to, interval, ok := parseMetricsRange(c, time.Hour)
+	if !ok {
+		return
+	}
+
+	groupBy := c.DefaultQuery("groupBy", "buffer")
+	if !services.IsValidThroughputGroup(groupBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Agrupamento inválido. Use 'buffer', 'rua', 'operator' ou 'none'."})
+		return
+	}
+	filter := services.ThroughputFilter{
+		Buffer:   c.Query("buffer"),
+		Rua:      c.Query("rua"),
+		Username: c.Query("username"),
+		Scheme:   c.Query("scheme"),
+	}
+
+	series, totals, err := services.GetThroughput(from, to, interval, groupBy, filter)
+	if err != nil {
+		log.Printf("Erro ao calcular throughput: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular o throughput."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"interval": interval.String(),
+		"groupBy":  groupBy,
+		"data":     series,
+		"totals":   totals,
+	})
+}
+
+// GetDwellMetrics devolve a distribuição do tempo de permanência (percentis e histograma)
+// das gaiolas que saíram no período, por buffer. Aceita ?from, ?to e ?buffer.
+func GetDwellMetrics(c *gin.Context) {
+	from, to, ok := parseMetricsPeriod(c)
+	if !ok {
+		return
+	}
+
+	distribution, err := services.GetHistoricalDwell(from, to, c.Query("buffer"))
+	if err != nil {
+		log.Printf("Erro ao calcular distribuição de permanência: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao calcular a distribuição de permanência."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "data": distribution})
+}
+
+// GetWebSocketMetrics devolve o estado do hub WebSocket: ligações ativas e respetivas filas
+// de envio, mensagens enviadas e descartadas e clientes desligados por lentidão.
+func GetWebSocketMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": websocket.H.Metrics()})
+}
@@ -0,0 +1,25 @@
+// backend/controllers/presenceController.go
+package controllers
+
+import (
+	"fifo-system/backend/websocket"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOnlinePresence devolve os utilizadores online em todas as instâncias, agrupados por
+// utilizador, com os dispositivos, a página ou posto atual e a hora da última ação.
+func GetOnlinePresence(c *gin.Context) {
+	users, err := websocket.H.OnlineUsers()
+	if err != nil {
+		log.Printf("Erro ao buscar utilizadores online: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar utilizadores online."})
+		return
+	}
+	if users == nil {
+		users = []websocket.OnlineUser{}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
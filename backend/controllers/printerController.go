@@ -0,0 +1,273 @@
+// backend/controllers/printerController.go
+package controllers
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// printerBody é o corpo aceite na criação e edição de impressoras.
+type printerBody struct {
+	Name     string `json:"name" binding:"required"`
+	Host     string `json:"host" binding:"required"`
+	Port     int    `json:"port"`
+	Language string `json:"language"`
+	Active   *bool  `json:"active"`
+}
+
+// toPrinter valida o corpo e aplica os valores por omissão (porta 9100, linguagem ZPL).
+func (b printerBody) toPrinter() (models.Printer, error) {
+	language := strings.ToUpper(strings.TrimSpace(b.Language))
+	if language == "" {
+		language = "ZPL"
+	}
+	if language != "ZPL" && language != "EPL" {
+		return models.Printer{}, errors.New("linguagem inválida. Use 'ZPL' ou 'EPL'")
+	}
+	port := b.Port
+	if port == 0 {
+		port = 9100
+	}
+	if port < 1 || port > 65535 {
+		return models.Printer{}, errors.New("porta inválida")
+	}
+	active := true
+	if b.Active != nil {
+		active = *b.Active
+	}
+	return models.Printer{
+		Name:     strings.TrimSpace(b.Name),
+		Host:     strings.TrimSpace(b.Host),
+		Port:     port,
+		Language: language,
+		Active:   active,
+	}, nil
+}
+
+// GetPrinters lista as impressoras registadas.
+func GetPrinters(c *gin.Context) {
+	var printers []models.Printer
+	if err := initializers.DB.Order("name asc").Find(&printers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar as impressoras."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": printers})
+}
+
+// CreatePrinter regista uma nova impressora de rede.
+func CreatePrinter(c *gin.Context) {
+	var body printerBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome e host da impressora são obrigatórios."})
+		return
+	}
+	printer, err := body.toPrinter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := initializers.DB.Create(&printer).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma impressora com este nome."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar a impressora."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impressora criada com sucesso.", "data": printer})
+}
+
+// UpdatePrinter altera os dados de uma impressora existente.
+func UpdatePrinter(c *gin.Context) {
+	var printer models.Printer
+	if err := initializers.DB.First(&printer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impressora não encontrada."})
+		return
+	}
+
+	var body printerBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome e host da impressora são obrigatórios."})
+		return
+	}
+	updated, err := body.toPrinter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Select garante que "Active: false" também é gravado.
+	if err := initializers.DB.Model(&printer).Select("Name", "Host", "Port", "Language", "Active").Updates(updated).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma impressora com este nome."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar a impressora."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impressora atualizada com sucesso."})
+}
+
+// withRemovedPrinters inclui as impressoras removidas no histórico de trabalhos.
+func withRemovedPrinters(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// DeletePrinter remove (soft delete) uma impressora. O histórico de trabalhos é mantido e os
+// trabalhos ainda pendentes falham. O nome é libertado (ganha o sufixo "#<id> removida"),
+// para que possa ser registada de novo uma impressora com o mesmo nome.
+func DeletePrinter(c *gin.Context) {
+	var printer models.Printer
+	if err := initializers.DB.First(&printer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impressora não encontrada."})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.PrintJob{}).Where("printer_id = ? AND status = ?", printer.ID, "PENDENTE").
+			Updates(map[string]interface{}{"status": "FALHOU", "last_error": services.PrinterRemovedError, "next_attempt": nil}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&printer).Update("name", fmt.Sprintf("%s #%d removida", printer.Name, printer.ID)).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&printer).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover a impressora."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Impressora removida com sucesso."})
+}
+
+// PrintLabels renderiza as etiquetas na linguagem da impressora e cria um trabalho
+// de impressão, enviado em segundo plano por services.PrintQueue.
+func PrintLabels(c *gin.Context) {
+	var body struct {
+		labelRenderRequest
+		PrinterID uint `json:"printerId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Impressora e lista de IDs são obrigatórias."})
+		return
+	}
+	opts, ok := validateLabelRequest(c, &body.labelRenderRequest)
+	if !ok {
+		return
+	}
+
+	var printer models.Printer
+	if err := initializers.DB.First(&printer, body.PrinterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impressora não encontrada."})
+		return
+	}
+	if !printer.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "A impressora selecionada está inativa."})
+		return
+	}
+
+	var (
+		payload []byte
+		err     error
+	)
+	if printer.Language == "EPL" {
+		payload, err = services.RenderLabelsEPL(body.TrackingIDs, opts)
+	} else {
+		payload, err = services.RenderLabelsZPL(body.TrackingIDs, opts)
+	}
+	if err != nil {
+		log.Printf("Erro ao renderizar etiquetas para impressão: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao gerar as etiquetas."})
+		return
+	}
+
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	job := models.PrintJob{
+		PrinterID:   printer.ID,
+		Status:      "PENDENTE",
+		TrackingIDs: strings.Join(body.TrackingIDs, ","),
+		LabelCount:  len(body.TrackingIDs),
+		Payload:     string(payload),
+		RequestedBy: user.Username,
+	}
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		logDetails := fmt.Sprintf("%d etiquetas enviadas para a impressora %s (trabalho #%d)", job.LabelCount, printer.Name, job.ID)
+		return services.CreateAuditLog(tx, user, "IMPRESSAO", logDetails)
+	})
+	if err != nil {
+		log.Printf("Erro ao criar trabalho de impressão: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar o trabalho de impressão."})
+		return
+	}
+
+	services.PrintQueue.Enqueue(job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Trabalho de impressão colocado na fila.", "jobId": job.ID})
+}
+
+// GetPrintJobs lista os trabalhos de impressão mais recentes, opcionalmente filtrados por estado.
+func GetPrintJobs(c *gin.Context) {
+	query := initializers.DB.Preload("Printer", withRemovedPrinters).Order("created_at desc").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var jobs []models.PrintJob
+	if err := query.Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os trabalhos de impressão."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetPrintJob devolve o estado de um trabalho de impressão.
+func GetPrintJob(c *gin.Context) {
+	var job models.PrintJob
+	if err := initializers.DB.Preload("Printer", withRemovedPrinters).First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trabalho de impressão não encontrado."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": job})
+}
+
+// RetryPrintJob volta a colocar na fila um trabalho que falhou definitivamente.
+func RetryPrintJob(c *gin.Context) {
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de trabalho inválido."})
+		return
+	}
+
+	result := initializers.DB.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", jobID, "FALHOU").
+		Updates(map[string]interface{}{"status": "PENDENTE", "attempts": 0, "next_attempt": nil})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao reenviar o trabalho de impressão."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Apenas trabalhos com falha podem ser reenviados."})
+		return
+	}
+
+	services.PrintQueue.Enqueue(uint(jobID))
+	c.JSON(http.StatusAccepted, gin.H{"message": "Trabalho de impressão colocado novamente na fila."})
+}
@@ -2,20 +2,25 @@
 package controllers
 
 import (
+	"errors"
 	"fifo-system/backend/initializers"
 	"fifo-system/backend/models"
+	"fifo-system/backend/services"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// GenerateQRCodeData atualizado para verificar TODOS os registros, incluindo os inativos.
+// GenerateQRCodeData sugere os próximos IDs livres do esquema pedido (GAIOLA por omissão),
+// a partir do contador do esquema e verificando TODOS os registros, incluindo os inativos.
 func GenerateQRCodeData(c *gin.Context) {
 	var body struct {
-		Quantity int `json:"quantity" binding:"required,gt=0"`
+		Quantity int    `json:"quantity" binding:"required,gt=0"`
+		Scheme   string `json:"scheme"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -23,55 +28,124 @@ func GenerateQRCodeData(c *gin.Context) {
 		return
 	}
 
+	scheme, err := services.FindActiveScheme(initializers.DB, body.Scheme)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Esquema de etiqueta inexistente ou inativo."})
+		return
+	}
+
 	var nextIDs []string
-	currentNumber := 1
+	currentNumber := scheme.NextNumber
+	if currentNumber < 1 {
+		currentNumber = 1
+	}
 
 	for len(nextIDs) < body.Quantity {
-		nextIDStr := fmt.Sprintf("CG%06d", currentNumber)
-		
+		nextIDStr, err := services.FormatTrackingID(scheme, currentNumber)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		candidates := []string{nextIDStr}
+		if scheme.CheckDigit {
+			// O número também não pode existir na forma antiga (sem dígito), para não haver
+			// duas etiquetas com a mesma sequência durante a migração.
+			candidates = append(candidates, nextIDStr[:len(nextIDStr)-1])
+		}
+
 		var count int64
 		// --- ALTERAÇÃO CRÍTICA: Unscoped() ---
 		// Procura em TODOS os registros, ignorando o status de soft delete (deleted_at).
 		// Isso garante que um ID já usado NUNCA seja gerado novamente.
-		initializers.DB.Model(&models.Package{}).Unscoped().Where("tracking_id = ?", nextIDStr).Count(&count)
+		initializers.DB.Model(&models.Package{}).Unscoped().Where("tracking_id IN ?", candidates).Count(&count)
 
 		if count == 0 {
 			nextIDs = append(nextIDs, nextIDStr)
 		}
-		
+
 		currentNumber++
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": nextIDs})
+	c.JSON(http.StatusOK, gin.H{"data": nextIDs, "scheme": scheme.Name})
 }
 
-
-// ConfirmQRCodeData permanece o mesmo.
+// ConfirmQRCodeData grava os códigos como PENDENTE e regista o lote que os originou.
 func ConfirmQRCodeData(c *gin.Context) {
 	var body struct {
 		TrackingIDs []string `json:"trackingIds" binding:"required"`
+		Reason      string   `json:"reason"` // Motivo opcional (ex: "Reposição doca EHA")
+		Scheme      string   `json:"scheme"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs é obrigatória."})
 		return
 	}
+	if len(body.TrackingIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Lista de IDs é obrigatória."})
+		return
+	}
 
-	var newPackages []models.Package
+	scheme, err := services.FindActiveScheme(initializers.DB, body.Scheme)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Esquema de etiqueta inexistente ou inativo."})
+		return
+	}
+	var highestNumber int64
 	for _, id := range body.TrackingIDs {
-		newPackages = append(newPackages, models.Package{
-			TrackingID:     id,
-			Buffer:         "PENDENTE",
-			Rua:            "INDEFINIDA",
-			EntryTimestamp: time.Time{},
-		})
+		n, err := services.ParseTrackingID(scheme, id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("O código %s não pertence ao esquema %s.", id, scheme.Name)})
+			return
+		}
+		if n > highestNumber {
+			highestNumber = n
+		}
 	}
 
-	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	batch := models.LabelBatch{
+		CreatedByID:       user.ID,
+		CreatedByUsername: user.Username,
+		CreatedByFullname: user.FullName,
+		Reason:            strings.TrimSpace(body.Reason),
+		Scheme:            scheme.Name,
+		Quantity:          len(body.TrackingIDs),
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+
+		var newPackages []models.Package
+		for _, id := range body.TrackingIDs {
+			newPackages = append(newPackages, models.Package{
+				TrackingID:     id,
+				Buffer:         "PENDENTE",
+				Rua:            "INDEFINIDA",
+				EntryTimestamp: time.Time{},
+				LabelBatchID:   &batch.ID,
+				Scheme:         scheme.Name,
+			})
+		}
 		if err := tx.Create(&newPackages).Error; err != nil {
 			return err
 		}
-		return nil
+
+		// Avança o contador do esquema para além do maior número confirmado.
+		if err := tx.Model(&models.TrackingIDScheme{}).Where("id = ?", scheme.ID).
+			Update("next_number", gorm.Expr("GREATEST(next_number, ?)", highestNumber+1)).Error; err != nil {
+			return err
+		}
+
+		logDetails := fmt.Sprintf("Lote de etiquetas #%d gerado com %d códigos (%s a %s)", batch.ID, batch.Quantity, body.TrackingIDs[0], body.TrackingIDs[len(body.TrackingIDs)-1])
+		if batch.Reason != "" {
+			logDetails += fmt.Sprintf(". Motivo: %s", batch.Reason)
+		}
+		return services.CreateAuditLog(tx, user, "GERACAO_ETIQUETAS", logDetails)
 	})
 
 	if err != nil {
@@ -79,7 +153,7 @@ func ConfirmQRCodeData(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Códigos confirmados e salvos com sucesso."})
+	c.JSON(http.StatusOK, gin.H{"message": "Códigos confirmados e salvos com sucesso.", "batchId": batch.ID})
 }
 
 // FindQRCodeData atualizado para encontrar TODOS os registros, incluindo inativos.
@@ -90,6 +164,15 @@ func FindQRCodeData(c *gin.Context) {
 		return
 	}
 
+	if err := services.ValidateTrackingID(initializers.DB, trackingID); err != nil {
+		if errors.Is(err, services.ErrInvalidCheckDigit) || errors.Is(err, services.ErrUnknownScheme) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar o código."})
+		return
+	}
+
 	var pkg models.Package
 	// --- ALTERAÇÃO CRÍTICA: Unscoped() ---
 	// Permite que o modal de "Buscar e Reimprimir" encontre um código mesmo que ele já
@@ -103,5 +186,11 @@ func FindQRCodeData(c *gin.Context) {
 		return
 	}
 
+	// Etiquetas anuladas pertencem a folhas perdidas e não devem voltar a ser impressas.
+	if pkg.Buffer == "ANULADO" {
+		c.JSON(http.StatusGone, gin.H{"error": "Este código foi anulado e não pode ser reimpresso."})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": []string{pkg.TrackingID}})
 }
\ No newline at end of file
@@ -0,0 +1,220 @@
+// backend/controllers/slaController.go
+package controllers
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slaRuleBody é o corpo aceite na criação e edição de regras de SLA.
+type slaRuleBody struct {
+	Buffer          string `json:"buffer" binding:"required"`
+	Profile         string `json:"profile"`
+	WarningMinutes  int    `json:"warningMinutes" binding:"required,gt=0"`
+	CriticalMinutes int    `json:"criticalMinutes" binding:"required,gt=0"`
+	Active          *bool  `json:"active"`
+}
+
+// toRule valida o corpo: buffer RTS ou EHA, perfil vazio (todos), P, M ou G, e aviso antes do crítico.
+func (b slaRuleBody) toRule() (models.SLARule, error) {
+	buffer := strings.ToUpper(strings.TrimSpace(b.Buffer))
+	if buffer != "RTS" && buffer != "EHA" {
+		return models.SLARule{}, errors.New("buffer inválido. Use 'RTS' ou 'EHA'")
+	}
+	profile := strings.ToUpper(strings.TrimSpace(b.Profile))
+	if profile != "" && profile != "P" && profile != "M" && profile != "G" {
+		return models.SLARule{}, errors.New("perfil inválido. Use 'P', 'M', 'G' ou deixe vazio para todos")
+	}
+	if b.WarningMinutes >= b.CriticalMinutes {
+		return models.SLARule{}, errors.New("o limite de aviso deve ser inferior ao limite crítico")
+	}
+	active := true
+	if b.Active != nil {
+		active = *b.Active
+	}
+	return models.SLARule{
+		Buffer:          buffer,
+		Profile:         profile,
+		WarningMinutes:  b.WarningMinutes,
+		CriticalMinutes: b.CriticalMinutes,
+		Active:          active,
+	}, nil
+}
+
+// GetSLARules lista as regras de SLA por buffer e perfil.
+func GetSLARules(c *gin.Context) {
+	var rules []models.SLARule
+	if err := initializers.DB.Order("buffer asc, profile asc").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar as regras de SLA."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// CreateSLARule cria os limites de aviso e crítico para um buffer (e opcionalmente um perfil).
+func CreateSLARule(c *gin.Context) {
+	var body slaRuleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Buffer e limites de aviso e crítico (em minutos) são obrigatórios."})
+		return
+	}
+	rule, err := body.toRule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := initializers.DB.Create(&rule).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma regra para este buffer e perfil."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar a regra de SLA."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de SLA criada com sucesso.", "data": rule})
+}
+
+// UpdateSLARule altera os limites ou o estado de uma regra de SLA.
+func UpdateSLARule(c *gin.Context) {
+	var rule models.SLARule
+	if err := initializers.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra de SLA não encontrada."})
+		return
+	}
+
+	var body slaRuleBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Buffer e limites de aviso e crítico (em minutos) são obrigatórios."})
+		return
+	}
+	updated, err := body.toRule()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Select garante que "Active: false" também é gravado.
+	if err := initializers.DB.Model(&rule).Select("Buffer", "Profile", "WarningMinutes", "CriticalMinutes", "Active").Updates(updated).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe uma regra para este buffer e perfil."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar a regra de SLA."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de SLA atualizada com sucesso."})
+}
+
+// DeleteSLARule remove definitivamente uma regra, para que o mesmo buffer e perfil possam
+// voltar a ser configurados. Os alertas já abertos mantêm-se.
+func DeleteSLARule(c *gin.Context) {
+	result := initializers.DB.Unscoped().Delete(&models.SLARule{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover a regra de SLA."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra de SLA não encontrada."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Regra de SLA removida com sucesso."})
+}
+
+// GetAlerts lista os alertas de SLA, por omissão os que ainda não foram resolvidos
+// (mais críticos e mais antigos primeiro). Aceita ?status= e ?buffer=.
+func GetAlerts(c *gin.Context) {
+	query := initializers.DB.Order("level desc, triggered_at asc").Limit(500)
+	switch status := strings.ToUpper(c.Query("status")); status {
+	case "":
+		query = query.Where("status <> ?", services.SLAStatusResolved)
+	case "TODOS":
+	default:
+		query = query.Where("status = ?", status)
+	}
+	if buffer := c.Query("buffer"); buffer != "" {
+		query = query.Where("buffer = ?", buffer)
+	}
+
+	var alerts []models.SLAAlert
+	if err := query.Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os alertas."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": alerts})
+}
+
+// AcknowledgeAlert marca um alerta como reconhecido (alguém já está a tratar da gaiola).
+func AcknowledgeAlert(c *gin.Context) {
+	alertID, ok := parseAlertID(c)
+	if !ok {
+		return
+	}
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	alert, err := services.AcknowledgeSLAAlert(alertID, user)
+	if err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	services.PublishSLAAlertChanges([]services.SLAAlertChange{{Event: services.SLAEventAcknowledged, Alert: alert}}, user)
+	c.JSON(http.StatusOK, gin.H{"message": "Alerta reconhecido.", "data": alert})
+}
+
+// ResolveAlert fecha um alerta manualmente, com uma nota opcional ({"resolution": "..."}).
+func ResolveAlert(c *gin.Context) {
+	alertID, ok := parseAlertID(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Resolution string `json:"resolution"`
+	}
+	// O corpo é opcional
+	_ = c.ShouldBindJSON(&body)
+
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+
+	alert, err := services.ResolveSLAAlert(alertID, user, strings.TrimSpace(body.Resolution))
+	if err != nil {
+		respondAlertError(c, err)
+		return
+	}
+
+	services.PublishSLAAlertChanges([]services.SLAAlertChange{{Event: services.SLAEventResolved, Alert: alert}}, user)
+	c.JSON(http.StatusOK, gin.H{"message": "Alerta resolvido.", "data": alert})
+}
+
+func parseAlertID(c *gin.Context) (uint, bool) {
+	alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de alerta inválido."})
+		return 0, false
+	}
+	return uint(alertID), true
+}
+
+func respondAlertError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAlertNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alerta não encontrado."})
+	case errors.Is(err, services.ErrAlertAlreadyResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": "O alerta já foi resolvido."})
+	default:
+		log.Printf("Erro ao atualizar alerta: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao atualizar o alerta."})
+	}
+}
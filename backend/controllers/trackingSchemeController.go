@@ -0,0 +1,115 @@
+// backend/controllers/trackingSchemeController.go
+package controllers
+
+import (
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var schemePrefixPattern = regexp.MustCompile(`^[A-Z]{1,6}$`)
+
+// GetTrackingSchemes lista os esquemas de TrackingID (usado também pelos filtros dos dashboards).
+func GetTrackingSchemes(c *gin.Context) {
+	var schemes []models.TrackingIDScheme
+	if err := initializers.DB.Order("name asc").Find(&schemes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os esquemas de etiqueta."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": schemes})
+}
+
+// CreateTrackingScheme cria um novo tipo de etiqueta com prefixo, largura e contador próprios.
+func CreateTrackingScheme(c *gin.Context) {
+	var body struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		Prefix      string `json:"prefix" binding:"required"`
+		Width       int    `json:"width" binding:"required,gte=3,lte=12"`
+		CheckDigit  bool   `json:"checkDigit"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome, prefixo e largura (3 a 12) são obrigatórios."})
+		return
+	}
+
+	prefix := strings.ToUpper(strings.TrimSpace(body.Prefix))
+	if !schemePrefixPattern.MatchString(prefix) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "O prefixo deve ter de 1 a 6 letras (A-Z)."})
+		return
+	}
+
+	scheme := models.TrackingIDScheme{
+		Name:        strings.ToUpper(strings.TrimSpace(body.Name)),
+		Description: body.Description,
+		Prefix:      prefix,
+		Width:       body.Width,
+		CheckDigit:  body.CheckDigit,
+		NextNumber:  1,
+		Active:      true,
+	}
+	if err := initializers.DB.Create(&scheme).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Já existe um esquema com este nome ou prefixo."})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar o esquema de etiqueta."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Esquema de etiqueta criado com sucesso.", "data": scheme})
+}
+
+// UpdateTrackingScheme altera a descrição, o dígito verificador, o estado ou o contador de um esquema.
+// Prefixo e largura não podem ser alterados, pois deixariam de reconhecer as etiquetas já impressas.
+func UpdateTrackingScheme(c *gin.Context) {
+	var scheme models.TrackingIDScheme
+	if err := initializers.DB.First(&scheme, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Esquema de etiqueta não encontrado."})
+		return
+	}
+
+	var body struct {
+		Description *string `json:"description"`
+		CheckDigit  *bool   `json:"checkDigit"`
+		Active      *bool   `json:"active"`
+		NextNumber  *int64  `json:"nextNumber"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos."})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if body.Description != nil {
+		updates["description"] = *body.Description
+	}
+	if body.CheckDigit != nil {
+		updates["check_digit"] = *body.CheckDigit
+	}
+	if body.Active != nil {
+		updates["active"] = *body.Active
+	}
+	if body.NextNumber != nil {
+		// O contador só pode avançar, para nunca voltar a sugerir números já usados.
+		if *body.NextNumber < scheme.NextNumber {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "O contador não pode ser reduzido."})
+			return
+		}
+		updates["next_number"] = *body.NextNumber
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nenhuma alteração indicada."})
+		return
+	}
+
+	if err := initializers.DB.Model(&scheme).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar o esquema de etiqueta."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Esquema de etiqueta atualizado com sucesso."})
+}
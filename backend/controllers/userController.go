@@ -4,8 +4,12 @@ package controllers
 import (
 	"errors"
 	"fifo-system/backend/config"
+	"fifo-system/backend/events"
 	"fifo-system/backend/initializers"
 	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fifo-system/backend/websocket"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -62,9 +66,23 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	actingUser, _ := c.Get("user")
+	publishUserChanged(events.UserCreated, user.ID, actingUser.(models.User))
 	c.JSON(http.StatusOK, gin.H{"message": "Utilizador criado com sucesso."})
 }
 
+// publishUserChanged recarrega o utilizador (com o papel e sem o hash da senha)
+// e publica UserChanged.
+func publishUserChanged(action string, userID uint, changedBy models.User) {
+	var user models.User
+	if err := initializers.DB.Preload("Role").Omit("password_hash").First(&user, userID).Error; err != nil {
+		log.Printf("Erro ao carregar utilizador %d para o evento %s: %v", userID, action, err)
+		return
+	}
+	changedBy.PasswordHash = ""
+	events.B.Publish(events.UserChanged{Action: action, User: user, ChangedBy: changedBy})
+}
+
 // GetUsers lista todos os utilizadores, incluindo a informação do seu papel.
 func GetUsers(c *gin.Context) {
 	var users []models.User
@@ -123,6 +141,7 @@ func Login(c *gin.Context) {
 		"fullName":    user.FullName, // Agora o FullName está sempre presente.
 		"role":        user.Role.Name,
 		"permissions": permissions,
+		"iat":         float64(time.Now().UnixMilli()) / 1000, // Com milissegundos: usado na revogação dos tokens (sessão terminada)
 		"exp":         time.Now().Add(config.AppConfig.JWTExpirationTime).Unix(),
 	})
 
@@ -168,6 +187,7 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	publishUserChanged(events.UserPasswordSet, currentUser.ID, currentUser)
 	c.JSON(http.StatusOK, gin.H{"message": "Senha alterada com sucesso."})
 }
 
@@ -230,7 +250,12 @@ func AdminUpdateUser(c *gin.Context) {
 	}
 
 	updates := models.User{FullName: body.FullName, RoleID: body.RoleID, Sector: body.Sector}
-	initializers.DB.Model(targetUser).Updates(updates)
+	if err := initializers.DB.Model(targetUser).Updates(updates).Error; err != nil {
+		log.Printf("Erro ao atualizar utilizador %s: %v", targetUser.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar o utilizador."})
+		return
+	}
+	publishUserChanged(events.UserUpdated, targetUser.ID, actingUser)
 	c.JSON(http.StatusOK, gin.H{"message": "Utilizador atualizado com sucesso."})
 }
 
@@ -257,7 +282,63 @@ func AdminResetPassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "É necessário fornecer a nova senha."})
 		return
 	}
-	newHash, _ := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
-	initializers.DB.Model(targetUser).Update("password_hash", string(newHash))
+	newHash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao processar a nova senha."})
+		return
+	}
+	if err := initializers.DB.Model(targetUser).Update("password_hash", string(newHash)).Error; err != nil {
+		log.Printf("Erro ao redefinir a senha de %s: %v", targetUser.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao redefinir a senha."})
+		return
+	}
+	publishUserChanged(events.UserPasswordReset, targetUser.ID, actingUser)
 	c.JSON(http.StatusOK, gin.H{"message": "Senha do utilizador redefinida com sucesso."})
 }
+
+// AdminTerminateSession termina a sessão de outro utilizador (ex: tablet partilhado deixado com
+// a sessão aberta): revoga os tokens já emitidos e fecha as suas ligações WebSocket em todas as
+// instâncias, depois de lhes enviar o motivo ({"reason": "..."}, opcional, até 200 caracteres).
+func AdminTerminateSession(c *gin.Context) {
+	actingUserInterface, _ := c.Get("user")
+	actingUser := actingUserInterface.(models.User)
+
+	targetUserIDStr := c.Param("id")
+	targetUserID, _ := strconv.ParseUint(targetUserIDStr, 10, 32)
+
+	targetUser, err := validateAdminAction(actingUser, uint(targetUserID))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dados inválidos."})
+			return
+		}
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if len([]rune(reason)) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "O motivo deve ter no máximo 200 caracteres."})
+		return
+	}
+	if reason == "" {
+		reason = "A sua sessão foi terminada por um líder."
+	}
+
+	if _, err := services.RevokeUserTokens(targetUser.ID, actingUser, reason); err != nil {
+		log.Printf("Erro ao revogar tokens de %s: %v", targetUser.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao terminar a sessão."})
+		return
+	}
+	if err := services.CreateAuditLog(initializers.DB, actingUser, "SESSAO_TERMINADA", fmt.Sprintf("Sessão de '%s' terminada. Motivo: %s", targetUser.Username, reason)); err != nil {
+		log.Printf("Erro ao registar fim de sessão no log de auditoria: %v", err)
+	}
+
+	websocket.H.DisconnectUser(targetUser.ID, reason, actingUser.FullName)
+	c.JSON(http.StatusOK, gin.H{"message": "Sessão terminada com sucesso."})
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssueWebSocketTicket devolve um ticket de uso único, válido durante 30 segundos, para abrir
+// o WebSocket em /api/ws?ticket=... sem pôr o JWT no URL (que fica nos logs dos proxies).
+func IssueWebSocketTicket(c *gin.Context) {
+	userInterface, _ := c.Get("user")
+	currentUser := userInterface.(models.User)
+
+	ticket, expiresAt, err := services.IssueWebSocketTicket(currentUser)
+	if err != nil {
+		log.Printf("Erro ao emitir ticket do WebSocket para %s: %v", currentUser.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao emitir o ticket do WebSocket."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expiresAt": expiresAt})
+}
@@ -0,0 +1,252 @@
+// backend/controllers/webhookController.go
+package controllers
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webhookBody é o corpo aceite na criação e edição de subscrições de webhook.
+type webhookBody struct {
+	Name   string   `json:"name" binding:"required"`
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required,min=1"`
+	Active *bool    `json:"active"`
+}
+
+// toSubscription valida o URL (http ou https) e os eventos subscritos.
+func (b webhookBody) toSubscription() (models.WebhookSubscription, error) {
+	parsed, err := url.Parse(strings.TrimSpace(b.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.WebhookSubscription{}, errors.New("URL inválido. Use um endereço http:// ou https://")
+	}
+
+	events := make([]string, 0, len(b.Events))
+	for _, event := range b.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		valid := false
+		for _, known := range services.WebhookEvents {
+			if event == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return models.WebhookSubscription{}, fmt.Errorf("evento inválido: %s. Use %s", event, strings.Join(services.WebhookEvents, ", "))
+		}
+		events = append(events, event)
+	}
+
+	active := true
+	if b.Active != nil {
+		active = *b.Active
+	}
+	return models.WebhookSubscription{
+		Name:   strings.TrimSpace(b.Name),
+		URL:    parsed.String(),
+		Events: strings.Join(events, ","),
+		Active: active,
+	}, nil
+}
+
+// GetWebhooks lista as subscrições de webhook (sem a chave de assinatura).
+func GetWebhooks(c *gin.Context) {
+	var subscriptions []models.WebhookSubscription
+	if err := initializers.DB.Order("name asc").Find(&subscriptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar os webhooks."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": subscriptions})
+}
+
+// CreateWebhook regista uma nova subscrição. A chave de assinatura é gerada aqui
+// e devolvida apenas nesta resposta.
+func CreateWebhook(c *gin.Context) {
+	var body webhookBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome, URL e pelo menos um evento são obrigatórios."})
+		return
+	}
+	subscription, err := body.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		log.Printf("Erro ao gerar chave de webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao gerar a chave do webhook."})
+		return
+	}
+	userInterface, _ := c.Get("user")
+	user := userInterface.(models.User)
+	subscription.Secret = secret
+	subscription.CreatedBy = user.Username
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subscription).Error; err != nil {
+			return err
+		}
+		logDetails := fmt.Sprintf("Webhook %s criado para %s (eventos: %s)", subscription.Name, subscription.URL, subscription.Events)
+		return services.CreateAuditLog(tx, user, "WEBHOOK_CRIADO", logDetails)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao criar o webhook."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook criado com sucesso. Guarde a chave: não voltará a ser mostrada.", "data": subscription, "secret": secret})
+}
+
+// UpdateWebhook altera o URL, os eventos ou o estado de uma subscrição.
+func UpdateWebhook(c *gin.Context) {
+	var subscription models.WebhookSubscription
+	if err := initializers.DB.First(&subscription, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado."})
+		return
+	}
+
+	var body webhookBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nome, URL e pelo menos um evento são obrigatórios."})
+		return
+	}
+	updated, err := body.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Select garante que "Active: false" também é gravado.
+	if err := initializers.DB.Model(&subscription).Select("Name", "URL", "Events", "Active").Updates(updated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar o webhook."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook atualizado com sucesso."})
+}
+
+// RotateWebhookSecret gera uma nova chave de assinatura. As entregas ainda pendentes
+// passam a ser assinadas com a nova chave.
+func RotateWebhookSecret(c *gin.Context) {
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		log.Printf("Erro ao gerar chave de webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro interno ao gerar a chave do webhook."})
+		return
+	}
+
+	result := initializers.DB.Model(&models.WebhookSubscription{}).Where("id = ?", c.Param("id")).Update("secret", secret)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao atualizar a chave do webhook."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Chave do webhook renovada. Guarde a chave: não voltará a ser mostrada.", "secret": secret})
+}
+
+// DeleteWebhook remove (soft delete) uma subscrição. O histórico de entregas é mantido.
+func DeleteWebhook(c *gin.Context) {
+	result := initializers.DB.Delete(&models.WebhookSubscription{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao remover o webhook."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook removido com sucesso."})
+}
+
+// TestWebhook envia um evento "ping" para a subscrição, para validar o URL e a assinatura.
+func TestWebhook(c *gin.Context) {
+	subscriptionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de webhook inválido."})
+		return
+	}
+
+	created, err := services.Webhooks.Deliver(services.WebhookEventPing, gin.H{"message": "Teste de webhook"}, uint(subscriptionID))
+	if err != nil {
+		log.Printf("Erro ao criar entrega de teste: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao enviar o teste."})
+		return
+	}
+	if created == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook não encontrado ou inativo."})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Evento de teste colocado na fila."})
+}
+
+// GetWebhookDeliveries devolve o registo de entregas mais recentes (sem o corpo).
+// Aceita ?subscriptionId=, ?status= e ?event=.
+func GetWebhookDeliveries(c *gin.Context) {
+	query := initializers.DB.Omit("Payload").Order("created_at desc").Limit(200)
+	if subscriptionID := c.Query("subscriptionId"); subscriptionID != "" {
+		query = query.Where("subscription_id = ?", subscriptionID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao buscar as entregas de webhook."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+// GetWebhookDelivery devolve uma entrega, incluindo o corpo enviado.
+func GetWebhookDelivery(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := initializers.DB.First(&delivery, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entrega não encontrada."})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": delivery})
+}
+
+// RetryWebhookDelivery volta a colocar na fila uma entrega que falhou definitivamente.
+func RetryWebhookDelivery(c *gin.Context) {
+	deliveryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de entrega inválido."})
+		return
+	}
+
+	result := initializers.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ?", deliveryID, "FALHOU").
+		Updates(map[string]interface{}{"status": "PENDENTE", "attempts": 0, "next_attempt": nil})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Falha ao reenviar a entrega."})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Apenas entregas com falha podem ser reenviadas."})
+		return
+	}
+
+	services.Webhooks.Enqueue(uint(deliveryID))
+	c.JSON(http.StatusAccepted, gin.H{"message": "Entrega colocada novamente na fila."})
+}
@@ -0,0 +1,93 @@
+// backend/events/bus.go
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// Event é um evento de domínio publicado depois de a transação que o originou ser confirmada.
+type Event interface {
+	EventName() string
+}
+
+// Handler trata um evento. É sempre chamado na goroutine do subscritor, nunca em Publish.
+type Handler func(Event)
+
+// subscriber guarda os eventos ainda por entregar numa fila sem limite, para que
+// Publish nunca bloqueie o pedido HTTP e nenhum evento seja descartado.
+type subscriber struct {
+	name    string
+	handler Handler
+	mu      sync.Mutex
+	queue   []Event
+	wake    chan struct{}
+}
+
+// Bus é um barramento de eventos em memória. Cada subscritor recebe os eventos pela ordem
+// em que foram publicados, numa goroutine própria: um subscritor lento atrasa-se a si
+// mesmo, mas não os outros.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []*subscriber
+}
+
+// B é o barramento global. Os subscritores são registados em main.
+var B = NewBus()
+
+// NewBus cria um barramento sem subscritores.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe regista um subscritor e inicia a goroutine que lhe entrega os eventos.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	sub := &subscriber{name: name, handler: handler, wake: make(chan struct{}, 1)}
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, sub)
+	b.mu.Unlock()
+	go sub.run()
+}
+
+// Publish entrega o evento a todos os subscritores, sem esperar que o tratem.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subscribers {
+		sub.mu.Lock()
+		sub.queue = append(sub.queue, event)
+		sub.mu.Unlock()
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *subscriber) run() {
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			s.handle(event)
+		}
+	}
+}
+
+// handle isola o pânico de um handler, para que um evento com problemas não pare o subscritor.
+func (s *subscriber) handle(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Pânico no subscritor de eventos %s ao tratar %s: %v", s.name, event.EventName(), r)
+		}
+	}()
+	s.handler(event)
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// testEvent é um evento numerado, para verificar a ordem de entrega.
+type testEvent int
+
+func (testEvent) EventName() string { return "teste" }
+
+// receive espera por n eventos do canal, ou falha o teste passado o timeout.
+func receive(t *testing.T, received <-chan testEvent, n int) []testEvent {
+	t.Helper()
+	var got []testEvent
+	for len(got) < n {
+		select {
+		case event := <-received:
+			got = append(got, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("recebidos %d eventos, esperados %d", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestBusDeliversInPublishOrder(t *testing.T) {
+	bus := NewBus()
+	received := make(chan testEvent, 1000)
+	bus.Subscribe("teste", func(e Event) { received <- e.(testEvent) })
+
+	const total = 1000
+	for i := 0; i < total; i++ {
+		bus.Publish(testEvent(i))
+	}
+
+	for i, event := range receive(t, received, total) {
+		if int(event) != i {
+			t.Fatalf("evento %d recebido na posição %d", event, i)
+		}
+	}
+}
+
+func TestBusSlowSubscriberDoesNotBlockOthers(t *testing.T) {
+	bus := NewBus()
+	release := make(chan struct{})
+	defer close(release)
+	bus.Subscribe("lento", func(Event) { <-release })
+	received := make(chan testEvent, 10)
+	bus.Subscribe("rapido", func(e Event) { received <- e.(testEvent) })
+
+	// O subscritor lento fica preso no primeiro evento; Publish não espera por ele
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(testEvent(i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish bloqueou à espera do subscritor lento")
+	}
+
+	if got := receive(t, received, 10); got[9] != 9 {
+		t.Fatalf("último evento %d, esperado 9", got[9])
+	}
+}
+
+func TestBusPanickingHandlerKeepsDelivering(t *testing.T) {
+	bus := NewBus()
+	received := make(chan testEvent, 3)
+	bus.Subscribe("teste", func(e Event) {
+		if e.(testEvent) == 1 {
+			panic("falha no handler")
+		}
+		received <- e.(testEvent)
+	})
+
+	for i := 0; i < 4; i++ {
+		bus.Publish(testEvent(i))
+	}
+
+	got := receive(t, received, 3)
+	if got[0] != 0 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("eventos recebidos %v, esperados [0 2 3]", got)
+	}
+}
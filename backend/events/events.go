@@ -0,0 +1,59 @@
+// backend/events/events.go
+package events
+
+import "fifo-system/backend/models"
+
+// PackageEntered é publicado depois da entrada de uma gaiola num buffer.
+type PackageEntered struct {
+	Package models.Package
+	Record  models.PackageEvent
+}
+
+// PackageExited é publicado depois da saída de uma gaiola (soft delete).
+type PackageExited struct {
+	Package models.Package
+	Record  models.PackageEvent
+}
+
+// PackageMoved é publicado depois de uma gaiola mudar de rua.
+type PackageMoved struct {
+	Package models.Package
+	FromRua string
+	Record  models.PackageEvent
+}
+
+// Ações de UserChanged.
+const (
+	UserCreated       = "CRIADO"
+	UserUpdated       = "ATUALIZADO"
+	UserPasswordReset = "SENHA_REDEFINIDA"
+	UserPasswordSet   = "SENHA_ALTERADA"
+)
+
+// UserChanged é publicado depois de um utilizador ser criado ou alterado.
+// User vem com o Role carregado e sem o hash da senha.
+type UserChanged struct {
+	Action    string
+	User      models.User
+	ChangedBy models.User
+}
+
+// SLAAlertChanged é publicado depois de um alerta de SLA ser aberto, escalado, reconhecido
+// ou resolvido. ChangedBy fica vazio nas alterações feitas pela avaliação automática.
+type SLAAlertChanged struct {
+	Event     string // opened, escalated, acknowledged ou resolved
+	Alert     models.SLAAlert
+	ChangedBy models.User
+}
+
+// AlertRuleChanged é publicado depois de uma regra de alerta disparar ou normalizar.
+type AlertRuleChanged struct {
+	Record models.AlertRuleEvent
+}
+
+func (PackageEntered) EventName() string   { return "PackageEntered" }
+func (PackageExited) EventName() string    { return "PackageExited" }
+func (PackageMoved) EventName() string     { return "PackageMoved" }
+func (UserChanged) EventName() string      { return "UserChanged" }
+func (SLAAlertChanged) EventName() string  { return "SLAAlertChanged" }
+func (AlertRuleChanged) EventName() string { return "AlertRuleChanged" }
@@ -4,15 +4,18 @@ package main
 import (
 	"fifo-system/backend/config"
 	"fifo-system/backend/controllers"
+	"fifo-system/backend/events"
 	"fifo-system/backend/initializers"
 	"fifo-system/backend/middleware"
 	"fifo-system/backend/models"
+	"fifo-system/backend/scheduler"
 	"fifo-system/backend/services"
 	"fifo-system/backend/websocket"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -26,24 +29,31 @@ func init() {
 
 func main() {
 	log.Println("Iniciando a migração da base de dados...")
-	err := initializers.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Package{}, &models.AuditLog{})
+	err := initializers.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Package{}, &models.AuditLog{}, &models.LabelBatch{}, &models.Printer{}, &models.PrintJob{}, &models.TrackingIDScheme{}, &models.LabelExpirationRun{}, &models.ScheduledJob{}, &models.BacklogSnapshot{}, &models.PackageEvent{}, &models.SLARule{}, &models.SLAAlert{}, &models.AlertRule{}, &models.AlertRuleEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.OnlineSession{}, &models.WebSocketTicket{}, &models.TokenRevocation{})
 	if err != nil {
 		log.Fatalf("Falha na migração da base de dados: %v", err)
 	}
 
 	seedData()
 	seedAdminUser()
+	seedTrackingSchemes()
 
+	registerEventSubscribers()
 	go websocket.H.Run()
+	go websocket.H.Listen()
+	go services.PrintQueue.Run()
+	go services.Webhooks.Run()
+	registerScheduledJobs()
+	go scheduler.S.Run()
 	r := gin.Default()
-
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:5173" // Ou o IP/porta do seu frontend dev
+	// O IP do cliente (limites do WebSocket, sessões online) só vem do X-Forwarded-For
+	// quando o pedido chega por um dos proxies de TRUSTED_PROXIES.
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES inválido: %v", err)
 	}
 
 	corsConfig := cors.Config{
-		AllowOrigins:     []string{frontendURL},
+		AllowOrigins:     config.AppConfig.FrontendOrigins, // FRONTEND_URL, também usadas na verificação de origem do WebSocket
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
 		AllowCredentials: true,
@@ -61,12 +71,16 @@ func main() {
 	// --- ADICIONAR ESTA LINHA ---
 	r.GET("/public/buffer-counts", controllers.GetBufferCounts)
 	// --- FIM DA ADIÇÃO ---
+	r.GET("/public/stream", websocket.ServeStream) // Atualizações da fila (SSE) para o modo convidado
+
+	// O WebSocket é autorizado pelo ticket de POST /api/ws/ticket, não pelo cabeçalho Authorization.
+	r.GET("/api/ws", websocket.ServeWs)
 
 	// --- ROTAS PRIVADAS / PROTEGIDAS ---
 	api := r.Group("/api")
 	api.Use(middleware.RequireAuth)
 	{
-		api.GET("/ws", websocket.ServeWs)
+		api.POST("/ws/ticket", controllers.IssueWebSocketTicket)
 		api.PUT("/user/change-password", controllers.ChangePassword)
 		api.GET("/fifo-queue", controllers.GetFIFOQueue) // Mantém a rota privada também
 		api.GET("/backlog-count", controllers.GetBacklogCount) // Mantém a rota privada também
@@ -77,15 +91,66 @@ func main() {
 		api.POST("/qrcodes/generate-data", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GenerateQRCodeData)
 		api.POST("/qrcodes/confirm", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.ConfirmQRCodeData)
 		api.GET("/qrcodes/find/:trackingId", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.FindQRCodeData)
+		api.GET("/qrcodes/batches", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GetLabelBatches)
+		api.GET("/qrcodes/batches/:id/reprint", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.ReprintLabelBatch)
+		api.POST("/qrcodes/batches/:id/void", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.VoidLabelBatch)
+		api.POST("/qrcodes/reactivate", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.ReactivateLabels)
+		api.GET("/qrcodes/expirations", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GetLabelExpirationRuns)
+		api.POST("/qrcodes/expirations/run", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.RunLabelExpiration)
+		api.POST("/labels/render", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.RenderLabels)
+		api.POST("/labels/print", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.PrintLabels)
+		api.GET("/labels/print-jobs", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GetPrintJobs)
+		api.GET("/labels/print-jobs/:id", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GetPrintJob)
+		api.POST("/labels/print-jobs/:id/retry", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.RetryPrintJob)
+		api.GET("/printers", middleware.RequirePermission("GENERATE_QR_CODES"), controllers.GetPrinters)
+		api.GET("/tracking-schemes", controllers.GetTrackingSchemes)
+		api.GET("/metrics/backlog", controllers.GetBacklogMetrics)
+		api.GET("/metrics/throughput", controllers.GetThroughputMetrics)
+		api.GET("/metrics/dwell", controllers.GetDwellMetrics)
+		api.GET("/alerts", controllers.GetAlerts)
+		api.PUT("/alerts/:id/acknowledge", middleware.RequirePermission("MANAGE_FIFO"), controllers.AcknowledgeAlert)
+		api.PUT("/alerts/:id/resolve", middleware.RequirePermission("MANAGE_FIFO"), controllers.ResolveAlert)
+		api.GET("/alert-rules", controllers.GetAlertRules)
+		api.GET("/alert-rules/metrics", controllers.GetAlertMetrics)
+		api.GET("/alert-rules/events", controllers.GetAlertRuleEvents)
 
 		management := api.Group("/management")
 		{
 			management.GET("/roles", middleware.RequirePermission("EDIT_USER"), controllers.GetRoles)
 			management.POST("/users", middleware.RequirePermission("CREATE_USER"), controllers.CreateUser)
 			management.GET("/users", middleware.RequirePermission("VIEW_USERS"), controllers.GetUsers)
+			management.GET("/presence", middleware.RequirePermission("VIEW_USERS"), controllers.GetOnlinePresence)
 			management.PUT("/users/:id", middleware.RequirePermission("EDIT_USER"), controllers.AdminUpdateUser)
 			management.PUT("/users/:id/reset-password", middleware.RequirePermission("RESET_PASSWORD"), controllers.AdminResetPassword)
+			management.POST("/users/:id/terminate-session", middleware.RequirePermission("TERMINATE_SESSIONS"), controllers.AdminTerminateSession)
 			management.GET("/logs", middleware.RequirePermission("VIEW_LOGS"), controllers.GetAuditLogs)
+			management.POST("/printers", middleware.RequirePermission("MANAGE_PRINTERS"), controllers.CreatePrinter)
+			management.PUT("/printers/:id", middleware.RequirePermission("MANAGE_PRINTERS"), controllers.UpdatePrinter)
+			management.DELETE("/printers/:id", middleware.RequirePermission("MANAGE_PRINTERS"), controllers.DeletePrinter)
+			management.POST("/tracking-schemes", middleware.RequirePermission("MANAGE_ID_SCHEMES"), controllers.CreateTrackingScheme)
+			management.PUT("/tracking-schemes/:id", middleware.RequirePermission("MANAGE_ID_SCHEMES"), controllers.UpdateTrackingScheme)
+			management.GET("/jobs", middleware.RequirePermission("MANAGE_JOBS"), controllers.GetScheduledJobs)
+			management.POST("/jobs/:name/run", middleware.RequirePermission("MANAGE_JOBS"), controllers.TriggerScheduledJob)
+			management.PUT("/jobs/:name/pause", middleware.RequirePermission("MANAGE_JOBS"), controllers.PauseScheduledJob)
+			management.PUT("/jobs/:name/resume", middleware.RequirePermission("MANAGE_JOBS"), controllers.ResumeScheduledJob)
+			management.GET("/ws/metrics", middleware.RequirePermission("MANAGE_JOBS"), controllers.GetWebSocketMetrics)
+			management.POST("/announcements", middleware.RequirePermission("SEND_ANNOUNCEMENTS"), controllers.SendAnnouncement)
+			management.GET("/sla-rules", middleware.RequirePermission("MANAGE_SLA"), controllers.GetSLARules)
+			management.POST("/sla-rules", middleware.RequirePermission("MANAGE_SLA"), controllers.CreateSLARule)
+			management.PUT("/sla-rules/:id", middleware.RequirePermission("MANAGE_SLA"), controllers.UpdateSLARule)
+			management.DELETE("/sla-rules/:id", middleware.RequirePermission("MANAGE_SLA"), controllers.DeleteSLARule)
+			management.POST("/alert-rules", middleware.RequirePermission("MANAGE_ALERT_RULES"), controllers.CreateAlertRule)
+			management.PUT("/alert-rules/:id", middleware.RequirePermission("MANAGE_ALERT_RULES"), controllers.UpdateAlertRule)
+			management.DELETE("/alert-rules/:id", middleware.RequirePermission("MANAGE_ALERT_RULES"), controllers.DeleteAlertRule)
+			management.GET("/webhooks", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.GetWebhooks)
+			management.POST("/webhooks", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.CreateWebhook)
+			management.PUT("/webhooks/:id", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.UpdateWebhook)
+			management.DELETE("/webhooks/:id", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.DeleteWebhook)
+			management.POST("/webhooks/:id/rotate-secret", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.RotateWebhookSecret)
+			management.POST("/webhooks/:id/test", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.TestWebhook)
+			management.GET("/webhook-deliveries", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.GetWebhookDeliveries)
+			management.GET("/webhook-deliveries/:id", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.GetWebhookDelivery)
+			management.POST("/webhook-deliveries/:id/retry", middleware.RequirePermission("MANAGE_WEBHOOKS"), controllers.RetryWebhookDelivery)
 		}
 	}
 
@@ -94,7 +159,7 @@ func main() {
 		port = "8080"
 	}
 	address := fmt.Sprintf(":%s", port)
-	log.Printf("Iniciando o servidor em %s, permitindo requisições de %s", address, frontendURL)
+	log.Printf("Iniciando o servidor em %s, permitindo requisições de %s", address, strings.Join(config.AppConfig.FrontendOrigins, ", "))
 	r.Run(address)
 }
 
@@ -134,6 +199,14 @@ func seedData() {
 		{Name: "RESET_PASSWORD", Description: "Pode redefinir a senha de outros utilizadores"},
 		{Name: "MOVE_PACKAGE", Description: "Pode mover um item para uma nova rua"},
 		{Name: "GENERATE_QR_CODES", Description: "Pode gerar novos QR Codes de rastreamento"},
+		{Name: "MANAGE_PRINTERS", Description: "Pode registar e configurar impressoras de etiquetas"},
+		{Name: "MANAGE_ID_SCHEMES", Description: "Pode criar e configurar os formatos de TrackingID"},
+		{Name: "MANAGE_JOBS", Description: "Pode consultar, executar e pausar as tarefas agendadas"},
+		{Name: "MANAGE_SLA", Description: "Pode configurar os limites de permanência (SLA) por buffer e perfil"},
+		{Name: "MANAGE_ALERT_RULES", Description: "Pode criar e configurar regras de alerta sobre as métricas da fila"},
+		{Name: "MANAGE_WEBHOOKS", Description: "Pode configurar webhooks para sistemas externos e consultar as entregas"},
+		{Name: "SEND_ANNOUNCEMENTS", Description: "Pode enviar avisos em tempo real aos utilizadores conectados"},
+		{Name: "TERMINATE_SESSIONS", Description: "Pode terminar a sessão de outros utilizadores e desligá-los do tempo real"},
 	}
 
 	for _, p := range allPermissions {
@@ -145,10 +218,14 @@ func seedData() {
 		"admin": {
 			"MANAGE_FIFO", "VIEW_LOGS", "VIEW_USERS", "CREATE_USER",
 			"EDIT_USER", "RESET_PASSWORD", "MOVE_PACKAGE", "GENERATE_QR_CODES",
+			"MANAGE_PRINTERS", "MANAGE_ID_SCHEMES", "MANAGE_JOBS", "MANAGE_SLA", "MANAGE_ALERT_RULES",
+			"MANAGE_WEBHOOKS", "SEND_ANNOUNCEMENTS", "TERMINATE_SESSIONS",
 		},
 		"leader": {
 			"MANAGE_FIFO", "VIEW_LOGS", "VIEW_USERS", "CREATE_USER",
 			"EDIT_USER", "RESET_PASSWORD", "MOVE_PACKAGE", "GENERATE_QR_CODES",
+			"MANAGE_PRINTERS", "MANAGE_ID_SCHEMES", "MANAGE_SLA", "MANAGE_ALERT_RULES",
+			"SEND_ANNOUNCEMENTS", "TERMINATE_SESSIONS",
 		},
 		"fifo": {
 			"MANAGE_FIFO", "MOVE_PACKAGE",
@@ -168,4 +245,80 @@ func seedData() {
 		}
 	}
 	log.Println("Sincronização de papéis e permissões concluída com sucesso.")
+}
+
+// seedTrackingSchemes garante que o esquema GAIOLA (prefixo CG, 6 algarismos) existe e associa-lhe
+// os pacotes antigos, criados antes de haver esquemas.
+func seedTrackingSchemes() {
+	scheme := models.TrackingIDScheme{
+		Name:        services.DefaultTrackingScheme,
+		Description: "Gaiolas (STAGE IN)",
+		Prefix:      "CG",
+		Width:       6,
+		CheckDigit:  config.AppConfig.TrackingCheckDigit,
+		NextNumber:  1,
+		Active:      true,
+	}
+	initializers.DB.FirstOrCreate(&scheme, models.TrackingIDScheme{Name: services.DefaultTrackingScheme})
+
+	result := initializers.DB.Model(&models.Package{}).Unscoped().
+		Where("(scheme IS NULL OR scheme = '') AND tracking_id LIKE ?", "CG%").
+		Update("scheme", services.DefaultTrackingScheme)
+	if result.Error != nil {
+		log.Printf("Falha ao associar pacotes antigos ao esquema %s: %v", services.DefaultTrackingScheme, result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("%d pacotes antigos associados ao esquema %s.", result.RowsAffected, services.DefaultTrackingScheme)
+	}
+}
+
+// registerEventSubscribers liga os consumidores aos eventos de domínio publicados pelos controllers
+// e pelas tarefas agendadas.
+// Para adicionar um novo consumidor basta subscrevê-lo aqui, sem alterar os controllers.
+func registerEventSubscribers() {
+	events.B.Subscribe("websocket", websocket.H.HandleEvent)
+	events.B.Subscribe("auditoria", services.AuditEvents)
+	events.B.Subscribe("webhooks", services.Webhooks.HandleEvent)
+}
+
+// registerScheduledJobs regista no scheduler todas as tarefas periódicas da aplicação.
+func registerScheduledJobs() {
+	if config.AppConfig.LabelExpirationAge > 0 && config.AppConfig.LabelExpirationInterval > 0 {
+		schedule := fmt.Sprintf("@every %s", config.AppConfig.LabelExpirationInterval)
+		if err := scheduler.S.Register("expirar-etiquetas", schedule, "Expira etiquetas PENDENTE nunca utilizadas", services.ExpireStaleLabelsJob); err != nil {
+			log.Printf("Falha ao registar tarefa: %v", err)
+		}
+	} else {
+		log.Println("Expiração automática de etiquetas desativada.")
+	}
+
+	if err := scheduler.S.Register("snapshot-backlog", config.AppConfig.BacklogSnapshotSchedule, "Grava o backlog de cada buffer para os gráficos de tendência", services.TakeBacklogSnapshotJob); err != nil {
+		log.Printf("Falha ao registar tarefa: %v", err)
+	}
+
+	// Os alertas abertos, escalados ou resolvidos são publicados no barramento de eventos
+	// (enviados aos clientes como "sla_alert", aos webhooks e à auditoria).
+	evaluateSLA := func() (string, error) {
+		changes, err := services.EvaluateSLA()
+		if err != nil {
+			return "", err
+		}
+		services.PublishSLAAlertChanges(changes, models.User{})
+		return services.SummarizeSLAChanges(changes), nil
+	}
+	if err := scheduler.S.Register("avaliar-sla", config.AppConfig.SLAEvaluationSchedule, "Abre e escala alertas de gaiolas acima do SLA do buffer", evaluateSLA); err != nil {
+		log.Printf("Falha ao registar tarefa: %v", err)
+	}
+
+	evaluateAlertRules := func() (string, error) {
+		events, err := services.EvaluateAlertRules()
+		// Mesmo com erro numa regra, os eventos já gravados são enviados.
+		services.PublishAlertRuleEvents(events)
+		if err != nil {
+			return "", err
+		}
+		return services.SummarizeAlertRuleEvents(events), nil
+	}
+	if err := scheduler.S.Register("avaliar-regras-alerta", config.AppConfig.AlertRulesSchedule, "Avalia as regras de alerta sobre as métricas da fila", evaluateAlertRules); err != nil {
+		log.Printf("Falha ao registar tarefa: %v", err)
+	}
 }
\ No newline at end of file
@@ -4,7 +4,9 @@ package middleware
 import (
 	"fifo-system/backend/config"
 	"fifo-system/backend/models"
+	"fifo-system/backend/services"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -20,11 +22,9 @@ func RequireAuth(c *gin.Context) {
 	if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
 		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 	} else {
-		tokenString = c.Query("token")
-		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de autorização não encontrado"})
-			return
-		}
+		// O token só é aceite no cabeçalho; o WebSocket usa um ticket (ver websocket.ServeWs).
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de autorização não encontrado"})
+		return
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -45,6 +45,17 @@ func RequireAuth(c *gin.Context) {
 			return
 		}
 
+		// Tokens anteriores ao campo "iat" são datados a partir da expiração
+		userID := uint(claims["sub"].(float64))
+		issuedAt := time.Unix(int64(claims["exp"].(float64)), 0).Add(-config.AppConfig.JWTExpirationTime)
+		if iat, ok := claims["iat"].(float64); ok {
+			issuedAt = time.UnixMilli(int64(math.Round(iat * 1000))) // Segundos com milissegundos
+		}
+		if services.TokenRevoked(userID, issuedAt) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A sessão foi terminada. Inicie sessão novamente."})
+			return
+		}
+
 		permissionsInterface := claims["permissions"].([]interface{})
 		permissions := make([]models.Permission, len(permissionsInterface))
 		for i, p := range permissionsInterface {
@@ -53,7 +64,7 @@ func RequireAuth(c *gin.Context) {
 
 		user := models.User{
 			Model: gorm.Model{
-				ID: uint(claims["sub"].(float64)),
+				ID: userID,
 			},
 			Username: claims["user"].(string),
 			FullName: claims["fullName"].(string),
@@ -78,17 +89,7 @@ func RequirePermission(permissionName string) gin.HandlerFunc {
 			return
 		}
 
-		user := userInterface.(models.User)
-		hasPermission := false
-
-		for _, p := range user.Role.Permissions {
-			if p.Name == permissionName {
-				hasPermission = true
-				break
-			}
-		}
-
-		if !hasPermission {
+		if !HasPermission(userInterface.(models.User), permissionName) {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permissões insuficientes para aceder a este recurso."})
 			return
 		}
@@ -96,3 +97,14 @@ func RequirePermission(permissionName string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// HasPermission indica se o papel do utilizador (tal como vem no token) inclui a permissão.
+// É a mesma verificação de RequirePermission, usada também pelos comandos do WebSocket.
+func HasPermission(user models.User, permissionName string) bool {
+	for _, p := range user.Role.Permissions {
+		if p.Name == permissionName {
+			return true
+		}
+	}
+	return false
+}
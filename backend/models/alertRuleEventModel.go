@@ -0,0 +1,19 @@
+// backend/models/alertRuleEventModel.go
+package models
+
+import "time"
+
+// AlertRuleEvent regista cada mudança de estado de uma AlertRule (disparo ou normalização).
+type AlertRuleEvent struct {
+	ID          uint      `gorm:"primarykey"`
+	AlertRuleID uint      `gorm:"not null;index"`
+	RuleName    string    `gorm:"not null"`
+	OccurredAt  time.Time `gorm:"not null;index"`
+	State       string    `gorm:"not null"` // DISPARADO ou NORMALIZADO
+	Severity    string    `gorm:"not null"`
+	Metric      string    `gorm:"not null"`
+	Buffer      string
+	Value       float64 `gorm:"not null"`
+	Threshold   float64 `gorm:"not null"`
+	Message     string  `gorm:"not null"`
+}
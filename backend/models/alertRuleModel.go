@@ -0,0 +1,34 @@
+// backend/models/alertRuleModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AlertRule é uma regra de alerta configurável sobre uma métrica da fila
+// (ex: "valor do backlog RTS > 5000" ou "saídas do EHA em 30 minutos == 0").
+type AlertRule struct {
+	gorm.Model
+	Name       string  `gorm:"unique;not null"`
+	Metric     string  `gorm:"not null"` // Ver services.AlertMetrics
+	Buffer     string  // Vazio = todos os buffers (quando a métrica o permite)
+	Comparator string  `gorm:"not null"` // >, >=, <, <= ou ==
+	Threshold  float64 `gorm:"not null"`
+	// Nas métricas de estado, tempo durante o qual a condição tem de se manter antes de disparar.
+	// Nas métricas de eventos (entradas, saídas, movimentações), período em que os eventos são contados.
+	WindowMinutes int `gorm:"not null;default:0"`
+	// Tempo mínimo entre dois disparos da mesma regra.
+	CooldownMinutes int    `gorm:"not null;default:0"`
+	Severity        string `gorm:"not null;default:'AVISO'"` // INFO, AVISO ou CRITICO
+	Active          bool   `gorm:"not null;default:true"`
+
+	// Estado da avaliação, atualizado pela tarefa "avaliar-regras-alerta".
+	State           string `gorm:"not null;default:'OK'"` // OK, PENDENTE ou DISPARADO
+	PendingSince    *time.Time
+	LastValue       float64
+	LastEvaluatedAt *time.Time
+	LastFiredAt     *time.Time
+	LastResolvedAt  *time.Time
+}
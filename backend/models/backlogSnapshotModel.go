@@ -0,0 +1,15 @@
+// backend/models/backlogSnapshotModel.go
+package models
+
+import "time"
+
+// BacklogSnapshot guarda o estado de um buffer num instante, para os gráficos de tendência.
+// Cada execução da tarefa "snapshot-backlog" grava uma linha por buffer.
+type BacklogSnapshot struct {
+	ID              uint      `gorm:"primarykey"`
+	TakenAt         time.Time `gorm:"not null;index:idx_backlog_snapshot_buffer_time,priority:2"`
+	Buffer          string    `gorm:"not null;index:idx_backlog_snapshot_buffer_time,priority:1"`
+	Count           int64     `gorm:"not null"`
+	Value           int64     `gorm:"not null"`
+	AvgDwellSeconds float64   `gorm:"not null"`
+}
@@ -0,0 +1,17 @@
+// backend/models/labelBatchModel.go
+package models
+
+import "gorm.io/gorm"
+
+// LabelBatch regista cada lote de etiquetas confirmado em ConfirmQRCodeData,
+// guardando quem o gerou, quando (CreatedAt) e porquê.
+type LabelBatch struct {
+	gorm.Model
+	CreatedByID       uint   `gorm:"not null;index"`
+	CreatedByUsername string `gorm:"not null"`
+	CreatedByFullname string `gorm:"not null"`
+	Reason            string
+	Scheme            string    `gorm:"not null;default:'GAIOLA'"`
+	Quantity          int       `gorm:"not null"`
+	Packages          []Package `gorm:"foreignKey:LabelBatchID" json:",omitempty"`
+}
@@ -0,0 +1,17 @@
+// backend/models/labelExpirationRunModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LabelExpirationRun é o relatório de cada execução da expiração de etiquetas PENDENTE.
+type LabelExpirationRun struct {
+	gorm.Model
+	Cutoff       time.Time `gorm:"not null"` // Etiquetas criadas antes deste instante foram expiradas
+	ExpiredCount int       `gorm:"not null"`
+	TrackingIDs  string    `gorm:"type:text"` // IDs expirados, separados por vírgula
+	TriggeredBy  string    `gorm:"not null"`  // "sistema" ou o utilizador que pediu a execução
+}
@@ -0,0 +1,29 @@
+// backend/models/onlineSessionModel.go
+package models
+
+import "time"
+
+// OnlineSession é uma ligação WebSocket ativa numa das instâncias do backend.
+// A lista de utilizadores online é montada a partir desta tabela, para incluir as
+// ligações de todas as instâncias. Cada instância renova LastSeenAt das suas sessões
+// periodicamente; sessões sem renovação (instância terminada) são removidas.
+// Cada sessão é um dispositivo: a presença é agregada por utilizador (ver websocket/presence.go).
+type OnlineSession struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	InstanceID  string    `gorm:"not null;index" json:"instanceId"`
+	UserID      uint      `gorm:"not null;index" json:"userId"`
+	Username    string    `gorm:"not null" json:"username"`
+	FullName    string    `json:"fullName"`
+	Role        string    `json:"role"`
+	Sector      string    `json:"sector"`
+	UserAgent   string    `json:"userAgent"`
+	IP          string    `json:"ip"`
+	ConnectedAt time.Time `gorm:"not null" json:"connectedAt"`
+	LastSeenAt  time.Time `gorm:"not null;index" json:"lastSeenAt"`
+	// Página do frontend ou posto de leitura indicados pelo cliente com a mensagem "presence".
+	Page          string     `json:"page"`
+	Station       string     `json:"station"`
+	PageChangedAt *time.Time `json:"pageChangedAt"`
+	// Última operação do utilizador (entrada, saída, movimentação ou leitura), em qualquer dispositivo.
+	LastActionAt *time.Time `json:"lastActionAt"`
+}
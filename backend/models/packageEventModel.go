@@ -0,0 +1,24 @@
+// backend/models/packageEventModel.go
+package models
+
+import "time"
+
+// PackageEvent é o registo estruturado de cada entrada, saída ou movimentação de uma gaiola,
+// gravado na mesma transação do AuditLog. Serve de base às métricas de throughput e de
+// permanência, sem depender do texto livre de AuditLog.Details.
+type PackageEvent struct {
+	ID           uint      `gorm:"primarykey"`
+	OccurredAt   time.Time `gorm:"not null;index"`
+	Type         string    `gorm:"not null;index"` // ENTRADA, SAIDA ou MOVIMENTACAO
+	PackageID    uint      `gorm:"not null;index"`
+	TrackingID   string    `gorm:"not null;index"`
+	Scheme       string
+	Buffer       string   `gorm:"not null"`
+	Rua          string   `gorm:"not null"` // Rua de destino (na saída, a rua de onde saiu)
+	FromRua      string   // Apenas em MOVIMENTACAO
+	Profile      string   `gorm:"not null;default:'N/A'"`
+	ProfileValue int      `gorm:"not null;default:0"`
+	UserID       uint     `gorm:"not null"`
+	Username     string   `gorm:"not null;index"`
+	DwellSeconds *float64 // Apenas em SAIDA: tempo desde a entrada
+}
@@ -16,4 +16,15 @@ type Package struct {
 	EntryTimestamp time.Time
 	Profile        string `gorm:"not null;default:'N/A'"` // Armazena "P", "M", "G", ou "N/A"
 	ProfileValue   int    `gorm:"not null;default:0"`
+	Scheme         string `gorm:"index"` // Nome do TrackingIDScheme a que o ID pertence
+
+	// Lote de etiquetas que originou este TrackingID (nulo para IDs criados fora de um lote).
+	LabelBatchID *uint `gorm:"index"`
+	// Preenchidos quando uma etiqueta não utilizada é anulada (Buffer "ANULADO").
+	VoidedAt   *time.Time
+	VoidReason string
+	// Preenchido quando uma etiqueta PENDENTE nunca utilizada expira (Buffer "EXPIRADO").
+	ExpiredAt *time.Time
+	// Preenchido quando uma etiqueta expirada é reativada; a idade para nova expiração conta a partir daqui.
+	ReactivatedAt *time.Time
 }
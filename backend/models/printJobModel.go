@@ -0,0 +1,26 @@
+// backend/models/printJobModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PrintJob regista cada envio de etiquetas para uma impressora de rede.
+// O conteúdo já renderizado fica guardado para que as novas tentativas enviem exatamente o mesmo.
+type PrintJob struct {
+	gorm.Model
+	PrinterID   uint    `gorm:"not null;index"`
+	Printer     Printer `json:",omitempty"`
+	Status      string  `gorm:"not null;index;default:'PENDENTE'"` // PENDENTE, ENVIANDO, CONCLUIDO, FALHOU
+	TrackingIDs string  `gorm:"type:text;not null"`                // IDs separados por vírgula
+	LabelCount  int     `gorm:"not null"`
+	Payload     string  `gorm:"type:text;not null" json:"-"`
+	Attempts    int     `gorm:"not null;default:0"`
+	LastError   string
+	RequestedBy string `gorm:"not null"`
+	NextAttempt *time.Time
+	ClaimedAt   *time.Time // Início do envio em curso; expira ao fim de services.printLease
+	CompletedAt *time.Time
+}
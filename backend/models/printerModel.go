@@ -0,0 +1,14 @@
+// backend/models/printerModel.go
+package models
+
+import "gorm.io/gorm"
+
+// Printer é uma impressora de etiquetas acessível por socket TCP bruto (porta 9100).
+type Printer struct {
+	gorm.Model
+	Name     string `gorm:"unique;not null"`
+	Host     string `gorm:"not null"`
+	Port     int    `gorm:"not null;default:9100"`
+	Language string `gorm:"not null;default:'ZPL'"` // "ZPL" ou "EPL"
+	Active   bool   `gorm:"not null;default:true"`
+}
@@ -0,0 +1,25 @@
+// backend/models/scheduledJobModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledJob guarda o estado persistido de cada tarefa agendada do scheduler,
+// partilhado entre todas as instâncias do Cloud Run.
+type ScheduledJob struct {
+	gorm.Model
+	Name           string `gorm:"unique;not null"`
+	Description    string
+	Schedule       string `gorm:"not null"` // Expressão cron (ex: "0 6 * * *" ou "@every 1h")
+	Paused         bool   `gorm:"not null;default:false"`
+	LastRunAt      *time.Time
+	LastStatus     string // EM_EXECUCAO, SUCESSO ou FALHOU
+	LastResult     string `gorm:"type:text"`
+	LastError      string `gorm:"type:text"`
+	LastDurationMs int64
+	LastInstance   string // Hostname da instância que executou
+	RunCount       int64  `gorm:"not null;default:0"`
+}
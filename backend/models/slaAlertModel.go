@@ -0,0 +1,30 @@
+// backend/models/slaAlertModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SLAAlert regista uma gaiola que ultrapassou o limite de permanência do seu buffer.
+// Existe no máximo um alerta por passagem da gaiola num buffer; quando a gaiola passa
+// o limite crítico, o mesmo alerta escala de AVISO para CRITICO.
+type SLAAlert struct {
+	gorm.Model
+	PackageID      uint      `gorm:"not null;index"`
+	TrackingID     string    `gorm:"not null;index"`
+	Buffer         string    `gorm:"not null"`
+	Rua            string    `gorm:"not null"`
+	Profile        string    `gorm:"not null"`
+	EntryTimestamp time.Time `gorm:"not null"`
+	Level          string    `gorm:"not null"`                        // AVISO ou CRITICO
+	Status         string    `gorm:"not null;index;default:'ABERTO'"` // ABERTO, RECONHECIDO ou RESOLVIDO
+	TriggeredAt    time.Time `gorm:"not null"`
+	EscalatedAt    *time.Time
+	AcknowledgedAt *time.Time
+	AcknowledgedBy string
+	ResolvedAt     *time.Time
+	ResolvedBy     string
+	Resolution     string
+}
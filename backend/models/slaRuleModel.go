@@ -0,0 +1,16 @@
+// backend/models/slaRuleModel.go
+package models
+
+import "gorm.io/gorm"
+
+// SLARule define os limites contratuais de permanência de um buffer.
+// Profile vazio aplica-se a todos os perfis; uma regra com perfil ("P", "M", "G")
+// tem prioridade sobre a regra geral do mesmo buffer.
+type SLARule struct {
+	gorm.Model
+	Buffer          string `gorm:"not null;uniqueIndex:idx_sla_rule_buffer_profile"`
+	Profile         string `gorm:"not null;default:'';uniqueIndex:idx_sla_rule_buffer_profile"`
+	WarningMinutes  int    `gorm:"not null"` // A partir daqui é aberto um alerta AVISO
+	CriticalMinutes int    `gorm:"not null"` // A partir daqui o alerta escala para CRITICO
+	Active          bool   `gorm:"not null;default:true"`
+}
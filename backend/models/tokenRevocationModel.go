@@ -0,0 +1,13 @@
+// backend/models/tokenRevocationModel.go
+package models
+
+import "time"
+
+// TokenRevocation invalida os tokens de um utilizador emitidos até RevokedAt (sessão terminada
+// por um líder). Há no máximo uma por utilizador: uma nova revogação substitui a anterior.
+type TokenRevocation struct {
+	UserID    uint      `gorm:"primarykey"`
+	RevokedAt time.Time `gorm:"not null;index"`
+	RevokedBy string    `gorm:"not null"`
+	Reason    string
+}
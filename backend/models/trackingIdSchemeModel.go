@@ -0,0 +1,17 @@
+// backend/models/trackingIdSchemeModel.go
+package models
+
+import "gorm.io/gorm"
+
+// TrackingIDScheme define o formato dos TrackingIDs de um tipo de etiqueta
+// (ex: GAIOLA = CG000123, PALETE = PL0042), com o seu próprio contador.
+type TrackingIDScheme struct {
+	gorm.Model
+	Name        string `gorm:"unique;not null"` // Ex: "GAIOLA", "PALETE", "TOTE"
+	Description string
+	Prefix      string `gorm:"unique;not null"`
+	Width       int    `gorm:"not null;default:6"` // Quantidade de algarismos do número sequencial
+	CheckDigit  bool   `gorm:"not null;default:false"`
+	NextNumber  int64  `gorm:"not null;default:1"` // Próximo número a sugerir na geração
+	Active      bool   `gorm:"not null;default:true"`
+}
@@ -0,0 +1,20 @@
+// backend/models/webSocketTicketModel.go
+package models
+
+import "time"
+
+// WebSocketTicket é uma autorização de uso único para abrir o WebSocket (/api/ws?ticket=...),
+// emitida por POST /api/ws/ticket. Guarda os dados do token que a pediu, para a ligação ter
+// o mesmo utilizador e as mesmas permissões sem que o JWT apareça no URL.
+// É guardada na base de dados porque a ligação pode chegar a outra instância.
+type WebSocketTicket struct {
+	ID          uint   `gorm:"primarykey"`
+	TicketHash  string `gorm:"not null;uniqueIndex"` // SHA-256 do ticket; o ticket em si não é guardado
+	UserID      uint   `gorm:"not null"`
+	Username    string `gorm:"not null"`
+	FullName    string
+	Role        string
+	Permissions string    // Permissões do token separadas por vírgula
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+}
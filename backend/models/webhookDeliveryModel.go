@@ -0,0 +1,25 @@
+// backend/models/webhookDeliveryModel.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookDelivery regista cada envio de um evento para uma WebhookSubscription.
+// O corpo fica guardado para que as novas tentativas enviem exatamente o mesmo (e a mesma assinatura).
+type WebhookDelivery struct {
+	gorm.Model
+	SubscriptionID uint                `gorm:"not null;index"`
+	Subscription   WebhookSubscription `json:",omitempty"`
+	Event          string              `gorm:"not null;index"`
+	Payload        string              `gorm:"type:text;not null"`
+	Status         string              `gorm:"not null;index;default:'PENDENTE'"` // PENDENTE, ENVIANDO, ENTREGUE, FALHOU
+	Attempts       int                 `gorm:"not null;default:0"`
+	LastStatusCode int
+	LastError      string `gorm:"type:text"`
+	NextAttempt    *time.Time
+	ClaimedAt      *time.Time // Início do envio em curso; expira ao fim de services.webhookLease
+	DeliveredAt    *time.Time
+}
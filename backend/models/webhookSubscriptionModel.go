@@ -0,0 +1,15 @@
+// backend/models/webhookSubscriptionModel.go
+package models
+
+import "gorm.io/gorm"
+
+// WebhookSubscription é um sistema externo (TMS, BI...) que recebe os eventos da fila por HTTP.
+type WebhookSubscription struct {
+	gorm.Model
+	Name      string `gorm:"not null"`
+	URL       string `gorm:"not null"`
+	Secret    string `gorm:"not null" json:"-"` // Chave do HMAC-SHA256 enviado em X-FIFO-Signature
+	Events    string `gorm:"not null"`          // Eventos separados por vírgula: entry, exit, move, alert
+	Active    bool   `gorm:"not null;default:true"`
+	CreatedBy string `gorm:"not null"`
+}
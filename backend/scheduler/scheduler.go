@@ -0,0 +1,237 @@
+// backend/scheduler/scheduler.go
+package scheduler
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// JobFunc é o trabalho executado por uma tarefa. O texto devolvido fica registado
+// como resultado da última execução (ex: "12 etiquetas expiradas").
+type JobFunc func() (string, error)
+
+// ErrJobNotFound é devolvido quando o nome da tarefa não está registado.
+var ErrJobNotFound = errors.New("tarefa não encontrada")
+
+type job struct {
+	name        string
+	description string
+	schedule    string
+	spec        cron.Schedule
+	fn          JobFunc
+}
+
+// Scheduler executa as tarefas registadas segundo expressões cron (no fuso de Brasília).
+// Cada execução é protegida por um advisory lock do Postgres, para que apenas uma
+// instância do Cloud Run execute cada tarefa.
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     map[string]*job
+	instance string
+}
+
+// S é o scheduler global, iniciado em main com go scheduler.S.Run().
+var S = &Scheduler{jobs: make(map[string]*job)}
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// JobStatus é a vista de uma tarefa devolvida pelos endpoints de administração.
+type JobStatus struct {
+	models.ScheduledJob
+	NextRunAt *time.Time `json:"nextRunAt"`
+}
+
+// alignedSchedule alinha um "@every <intervalo>" a múltiplos fixos do intervalo (contados desde
+// o instante zero), em vez de contar a partir da hora local de cada instância. Assim todas as
+// instâncias calculam a mesma ocorrência e a verificação de LastRunAt em execute deixa passar
+// apenas uma execução por intervalo.
+type alignedSchedule struct {
+	every time.Duration
+}
+
+func (a alignedSchedule) Next(t time.Time) time.Time {
+	return t.Truncate(a.every).Add(a.every).In(t.Location())
+}
+
+// parseSchedule interpreta a expressão cron; os "@every" ficam alinhados com alignedSchedule.
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	spec, err := cronParser.Parse(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if every, ok := spec.(cron.ConstantDelaySchedule); ok {
+		return alignedSchedule{every: every.Delay}, nil
+	}
+	return spec, nil
+}
+
+// Register adiciona uma tarefa ao registo. Deve ser chamado antes de Run.
+func (s *Scheduler) Register(name, schedule, description string, fn JobFunc) error {
+	spec, err := parseSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("expressão cron inválida para a tarefa %s: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &job{name: name, description: description, schedule: schedule, spec: spec, fn: fn}
+	return nil
+}
+
+// Run sincroniza o registo com a tabela scheduled_jobs e inicia um ciclo por tarefa.
+func (s *Scheduler) Run() {
+	s.instance, _ = os.Hostname()
+
+	s.mu.Lock()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		row := models.ScheduledJob{Name: j.name}
+		if err := initializers.DB.Where(models.ScheduledJob{Name: j.name}).
+			Assign(models.ScheduledJob{Schedule: j.schedule, Description: j.description}).
+			FirstOrCreate(&row).Error; err != nil {
+			log.Printf("Erro ao registar a tarefa agendada %s: %v", j.name, err)
+			continue
+		}
+		go s.loop(j)
+	}
+	log.Printf("Scheduler iniciado com %d tarefas.", len(jobs))
+}
+
+func (s *Scheduler) loop(j *job) {
+	for {
+		next := j.spec.Next(services.GetBrasiliaTime())
+		time.Sleep(time.Until(next))
+		s.execute(j, next, false)
+	}
+}
+
+// Trigger executa uma tarefa de imediato (mesmo que esteja em pausa), em segundo plano.
+func (s *Scheduler) Trigger(name string) error {
+	j, ok := s.get(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	go s.execute(j, services.GetBrasiliaTime(), true)
+	return nil
+}
+
+// SetPaused pausa ou retoma uma tarefa. O estado é persistido, afetando todas as instâncias.
+func (s *Scheduler) SetPaused(name string, paused bool) error {
+	if _, ok := s.get(name); !ok {
+		return ErrJobNotFound
+	}
+	return initializers.DB.Model(&models.ScheduledJob{}).Where("name = ?", name).Update("paused", paused).Error
+}
+
+// List devolve o estado persistido de todas as tarefas registadas, com a próxima execução prevista.
+func (s *Scheduler) List() ([]JobStatus, error) {
+	var rows []models.ScheduledJob
+	if err := initializers.DB.Order("name asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	now := services.GetBrasiliaTime()
+	statuses := make([]JobStatus, 0, len(rows))
+	for _, row := range rows {
+		j, ok := s.get(row.Name)
+		if !ok {
+			continue // Tarefa antiga que já não está registada no código
+		}
+		status := JobStatus{ScheduledJob: row}
+		if !row.Paused {
+			next := j.spec.Next(now)
+			status.NextRunAt = &next
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+	return statuses, nil
+}
+
+func (s *Scheduler) get(name string) (*job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	return j, ok
+}
+
+// execute corre a tarefa numa ligação dedicada que detém o advisory lock durante a execução.
+// As execuções agendadas são ignoradas se outra instância já tiver corrido a mesma ocorrência.
+func (s *Scheduler) execute(j *job, scheduledAt time.Time, manual bool) {
+	lockKey := "fifo-job:" + j.name
+
+	err := initializers.DB.Connection(func(conn *gorm.DB) error {
+		var locked bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(hashtext(?))", lockKey).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("falha ao obter advisory lock: %w", err)
+		}
+		if !locked {
+			return nil // Outra instância está a executar esta tarefa
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", lockKey)
+
+		var row models.ScheduledJob
+		if err := conn.Where("name = ?", j.name).First(&row).Error; err != nil {
+			return fmt.Errorf("falha ao carregar estado da tarefa: %w", err)
+		}
+		if !manual {
+			if row.Paused {
+				return nil
+			}
+			if row.LastRunAt != nil && !row.LastRunAt.Before(scheduledAt) {
+				return nil
+			}
+		}
+
+		startedAt := services.GetBrasiliaTime()
+		conn.Model(&row).Updates(map[string]interface{}{
+			"last_status":   "EM_EXECUCAO",
+			"last_run_at":   startedAt,
+			"last_instance": s.instance,
+		})
+
+		result, runErr := runSafely(j.fn)
+
+		updates := map[string]interface{}{
+			"last_status":      "SUCESSO",
+			"last_result":      result,
+			"last_error":       "",
+			"last_duration_ms": time.Since(startedAt).Milliseconds(),
+			"run_count":        gorm.Expr("run_count + 1"),
+		}
+		if runErr != nil {
+			updates["last_status"] = "FALHOU"
+			updates["last_error"] = runErr.Error()
+			log.Printf("Tarefa agendada %s falhou: %v", j.name, runErr)
+		}
+		return conn.Model(&row).Updates(updates).Error
+	})
+	if err != nil {
+		log.Printf("Erro ao executar a tarefa agendada %s: %v", j.name, err)
+	}
+}
+
+// runSafely impede que um panic numa tarefa derrube o processo.
+func runSafely(fn JobFunc) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEveryScheduleIsAlignedAcrossInstances(t *testing.T) {
+	spec, err := parseSchedule("@every 1h")
+	if err != nil {
+		t.Fatalf("parseSchedule: %v", err)
+	}
+
+	// Duas instâncias que acordam em instantes diferentes do mesmo intervalo calculam a mesma ocorrência
+	brasilia := time.FixedZone("BRT", -3*60*60)
+	a := spec.Next(time.Date(2026, 3, 10, 14, 5, 12, 0, brasilia))
+	b := spec.Next(time.Date(2026, 3, 10, 14, 47, 0, 0, brasilia))
+	if !a.Equal(b) {
+		t.Fatalf("ocorrências diferentes: %s e %s", a, b)
+	}
+	if want := time.Date(2026, 3, 10, 15, 0, 0, 0, brasilia); !a.Equal(want) {
+		t.Fatalf("ocorrência %s, esperada %s", a, want)
+	}
+
+	// Num limite exato a ocorrência seguinte é a do intervalo seguinte
+	if next := spec.Next(a); !next.Equal(a.Add(time.Hour)) {
+		t.Fatalf("ocorrência seguinte %s, esperada %s", next, a.Add(time.Hour))
+	}
+}
+
+func TestCronScheduleIsUnchanged(t *testing.T) {
+	spec, err := parseSchedule("0 6 * * *")
+	if err != nil {
+		t.Fatalf("parseSchedule: %v", err)
+	}
+	brasilia := time.FixedZone("BRT", -3*60*60)
+	next := spec.Next(time.Date(2026, 3, 10, 14, 5, 0, 0, brasilia))
+	if want := time.Date(2026, 3, 11, 6, 0, 0, 0, brasilia); !next.Equal(want) {
+		t.Fatalf("ocorrência %s, esperada %s", next, want)
+	}
+}
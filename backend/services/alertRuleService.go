@@ -0,0 +1,269 @@
+// backend/services/alertRuleService.go
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/events"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Estados de uma AlertRule e dos AlertRuleEvent.
+const (
+	AlertRuleStateOK       = "OK"
+	AlertRuleStatePending  = "PENDENTE"
+	AlertRuleStateFiring   = "DISPARADO"
+	AlertRuleStateResolved = "NORMALIZADO"
+)
+
+// AlertMetric descreve uma métrica disponível para as regras de alerta.
+type AlertMetric struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Event          bool   `json:"event"`          // Conta eventos na janela em vez de ler o estado atual
+	BufferRequired bool   `json:"bufferRequired"` // Só faz sentido para RTS ou EHA
+}
+
+// AlertMetrics são as métricas aceites em AlertRule.Metric.
+var AlertMetrics = []AlertMetric{
+	{Name: "backlog_count", Description: "Quantidade de gaiolas (backlog total ou do buffer)"},
+	{Name: "backlog_value", Description: "Soma dos valores de perfil (backlog total ou do buffer)"},
+	{Name: "avg_dwell_minutes", Description: "Tempo médio de permanência no buffer, em minutos", BufferRequired: true},
+	{Name: "p90_dwell_minutes", Description: "Percentil 90 da permanência no buffer, em minutos", BufferRequired: true},
+	{Name: "max_dwell_minutes", Description: "Permanência da gaiola mais antiga do buffer, em minutos", BufferRequired: true},
+	{Name: "over_sla_count", Description: "Gaiolas acima do limite de SLA do buffer", BufferRequired: true},
+	{Name: "entries", Description: "Entradas na janela", Event: true},
+	{Name: "exits", Description: "Saídas na janela", Event: true},
+	{Name: "moves", Description: "Movimentações na janela", Event: true},
+}
+
+var alertMetricEventTypes = map[string]string{"entries": "ENTRADA", "exits": "SAIDA", "moves": "MOVIMENTACAO"}
+
+// FindAlertMetric devolve a métrica com o nome indicado.
+func FindAlertMetric(name string) (AlertMetric, bool) {
+	for _, metric := range AlertMetrics {
+		if metric.Name == name {
+			return metric, true
+		}
+	}
+	return AlertMetric{}, false
+}
+
+// ValidateAlertRule verifica a métrica, o buffer, o comparador e a severidade de uma regra.
+func ValidateAlertRule(rule models.AlertRule) error {
+	metric, ok := FindAlertMetric(rule.Metric)
+	if !ok {
+		return fmt.Errorf("métrica desconhecida: %s", rule.Metric)
+	}
+	switch rule.Buffer {
+	case "", "RTS", "EHA", "SAL":
+	default:
+		return errors.New("buffer inválido. Use 'RTS', 'EHA', 'SAL' ou deixe vazio")
+	}
+	if metric.BufferRequired && rule.Buffer != "RTS" && rule.Buffer != "EHA" {
+		return fmt.Errorf("a métrica %s exige o buffer RTS ou EHA", rule.Metric)
+	}
+	if metric.Event && rule.WindowMinutes <= 0 {
+		return fmt.Errorf("a métrica %s exige uma janela em minutos", rule.Metric)
+	}
+	switch rule.Comparator {
+	case ">", ">=", "<", "<=", "==":
+	default:
+		return errors.New("comparador inválido. Use >, >=, <, <= ou ==")
+	}
+	switch rule.Severity {
+	case "INFO", "AVISO", "CRITICO":
+	default:
+		return errors.New("severidade inválida. Use INFO, AVISO ou CRITICO")
+	}
+	if rule.WindowMinutes < 0 || rule.CooldownMinutes < 0 {
+		return errors.New("a janela e o intervalo entre disparos não podem ser negativos")
+	}
+	return nil
+}
+
+func compareAlertValue(value float64, comparator string, threshold float64) bool {
+	switch comparator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	}
+	return false
+}
+
+// alertMetricValue calcula o valor atual da métrica da regra. As métricas de estado usam
+// o mesmo QueueState das mensagens do WebSocket; as de eventos contam PackageEvent na janela.
+func alertMetricValue(db *gorm.DB, rule models.AlertRule, state QueueState, now time.Time) (float64, error) {
+	if eventType, ok := alertMetricEventTypes[rule.Metric]; ok {
+		query := db.Model(&models.PackageEvent{}).
+			Where("type = ? AND occurred_at >= ?", eventType, now.Add(-time.Duration(rule.WindowMinutes)*time.Minute))
+		if rule.Buffer != "" {
+			query = query.Where("buffer = ?", rule.Buffer)
+		}
+		var count int64
+		err := query.Count(&count).Error
+		return float64(count), err
+	}
+
+	switch rule.Metric {
+	case "backlog_count":
+		if rule.Buffer == "" {
+			return float64(state.BacklogCount), nil
+		}
+		return float64(state.BufferCounts[rule.Buffer]), nil
+	case "backlog_value":
+		if rule.Buffer == "" {
+			return float64(state.BacklogValue), nil
+		}
+		return float64(state.BufferValues[rule.Buffer]), nil
+	case "avg_dwell_minutes":
+		return state.BufferAvgTimes[rule.Buffer] / 60, nil
+	case "p90_dwell_minutes":
+		return state.BufferDwell[rule.Buffer].P90 / 60, nil
+	case "max_dwell_minutes":
+		return state.BufferDwell[rule.Buffer].Max / 60, nil
+	case "over_sla_count":
+		return float64(state.BufferDwell[rule.Buffer].OverSLA), nil
+	}
+	return 0, fmt.Errorf("métrica desconhecida: %s", rule.Metric)
+}
+
+// describeAlertRule monta o texto do alerta (ex: "backlog_value (RTS) = 5230, limite > 5000").
+func describeAlertRule(rule models.AlertRule, value float64) string {
+	subject := rule.Metric
+	if rule.Buffer != "" {
+		subject += fmt.Sprintf(" (%s)", rule.Buffer)
+	}
+	if metric, ok := FindAlertMetric(rule.Metric); ok && metric.Event {
+		subject += fmt.Sprintf(" em %d min", rule.WindowMinutes)
+	}
+	return fmt.Sprintf("%s: %s = %g, limite %s %g", rule.Name, subject, value, rule.Comparator, rule.Threshold)
+}
+
+// EvaluateAlertRules avalia todas as regras ativas e grava as mudanças de estado.
+// Uma regra passa a PENDENTE quando a condição se verifica, dispara quando se mantém
+// durante a janela (métricas de estado) e respeitado o intervalo entre disparos,
+// e volta a OK (registando NORMALIZADO) quando a condição deixa de se verificar.
+// Devolve os eventos gravados, para serem enviados aos clientes.
+func EvaluateAlertRules() ([]models.AlertRuleEvent, error) {
+	var rules []models.AlertRule
+	if err := initializers.DB.Where("active = ?", true).Order("id asc").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("erro ao buscar regras de alerta: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	state, err := GetCurrentQueueState()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar estado da fila: %w", err)
+	}
+	now := GetBrasiliaTime()
+
+	var events []models.AlertRuleEvent
+	for _, rule := range rules {
+		value, err := alertMetricValue(initializers.DB, rule, state, now)
+		if err != nil {
+			return events, fmt.Errorf("erro ao calcular a métrica da regra %s: %w", rule.Name, err)
+		}
+		metric, _ := FindAlertMetric(rule.Metric)
+		matched := compareAlertValue(value, rule.Comparator, rule.Threshold)
+
+		newState := rule.State
+		pendingSince := rule.PendingSince
+		var eventState string
+		switch {
+		case !matched && rule.State == AlertRuleStateFiring:
+			newState, pendingSince, eventState = AlertRuleStateOK, nil, AlertRuleStateResolved
+		case !matched:
+			newState, pendingSince = AlertRuleStateOK, nil
+		case rule.State == AlertRuleStateFiring:
+			// Continua disparada, apenas o valor é atualizado
+		default:
+			if pendingSince == nil {
+				pendingSince = &now
+			}
+			held := metric.Event || now.Sub(*pendingSince) >= time.Duration(rule.WindowMinutes)*time.Minute
+			cooledDown := rule.LastFiredAt == nil || now.Sub(*rule.LastFiredAt) >= time.Duration(rule.CooldownMinutes)*time.Minute
+			if held && cooledDown {
+				newState, pendingSince, eventState = AlertRuleStateFiring, nil, AlertRuleStateFiring
+			} else {
+				newState = AlertRuleStatePending
+			}
+		}
+
+		updates := map[string]interface{}{
+			"state":             newState,
+			"pending_since":     pendingSince,
+			"last_value":        value,
+			"last_evaluated_at": now,
+		}
+		switch eventState {
+		case AlertRuleStateFiring:
+			updates["last_fired_at"] = now
+		case AlertRuleStateResolved:
+			updates["last_resolved_at"] = now
+		}
+
+		err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.AlertRule{}).Where("id = ?", rule.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			if eventState == "" {
+				return nil
+			}
+			event := models.AlertRuleEvent{
+				AlertRuleID: rule.ID,
+				RuleName:    rule.Name,
+				OccurredAt:  now,
+				State:       eventState,
+				Severity:    rule.Severity,
+				Metric:      rule.Metric,
+				Buffer:      rule.Buffer,
+				Value:       value,
+				Threshold:   rule.Threshold,
+				Message:     describeAlertRule(rule, value),
+			}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+			events = append(events, event)
+			return nil
+		})
+		if err != nil {
+			return events, fmt.Errorf("falha ao gravar o estado da regra %s: %w", rule.Name, err)
+		}
+	}
+	return events, nil
+}
+
+// PublishAlertRuleEvents publica os disparos e normalizações no barramento de eventos, depois de gravados.
+func PublishAlertRuleEvents(records []models.AlertRuleEvent) {
+	for _, record := range records {
+		events.B.Publish(events.AlertRuleChanged{Record: record})
+	}
+}
+
+// SummarizeAlertRuleEvents descreve os eventos para o resultado da tarefa agendada.
+func SummarizeAlertRuleEvents(events []models.AlertRuleEvent) string {
+	fired, resolved := 0, 0
+	for _, event := range events {
+		if event.State == AlertRuleStateFiring {
+			fired++
+		} else {
+			resolved++
+		}
+	}
+	return fmt.Sprintf("%d regras disparadas, %d normalizadas", fired, resolved)
+}
@@ -2,8 +2,11 @@
 package services
 
 import (
+	"fifo-system/backend/events"
+	"fifo-system/backend/initializers"
 	"fifo-system/backend/models"
 	"fmt"
+	"log"
 
 	"gorm.io/gorm"
 )
@@ -23,3 +26,75 @@ func CreateAuditLog(tx *gorm.DB, user models.User, action string, details string
 
 	return nil
 }
+
+// AuditEvents é o subscritor "auditoria" do barramento de eventos: regista no AuditLog
+// as alterações de utilizadores e as alterações automáticas dos alertas e das regras de alerta. As entradas, saídas
+// e movimentações, tal como o reconhecimento e a resolução manual de alertas, continuam a ser
+// registadas dentro da própria transação, para que nunca se percam.
+func AuditEvents(e events.Event) {
+	switch e := e.(type) {
+	case events.UserChanged:
+		auditUserChange(e)
+	case events.SLAAlertChanged:
+		auditSLAAlertChange(e)
+	case events.AlertRuleChanged:
+		auditAlertRuleChange(e)
+	}
+}
+
+func auditUserChange(changed events.UserChanged) {
+	var details string
+	switch changed.Action {
+	case events.UserCreated:
+		details = fmt.Sprintf("Utilizador %s (%s) criado com o papel %s no setor %s", changed.User.Username, changed.User.FullName, changed.User.Role.Name, changed.User.Sector)
+	case events.UserUpdated:
+		details = fmt.Sprintf("Utilizador %s atualizado: nome %s, papel %s, setor %s", changed.User.Username, changed.User.FullName, changed.User.Role.Name, changed.User.Sector)
+	case events.UserPasswordReset:
+		details = fmt.Sprintf("Senha do utilizador %s redefinida", changed.User.Username)
+	case events.UserPasswordSet:
+		details = fmt.Sprintf("O utilizador %s alterou a sua senha", changed.User.Username)
+	default:
+		details = fmt.Sprintf("Utilizador %s alterado (%s)", changed.User.Username, changed.Action)
+	}
+
+	if err := CreateAuditLog(initializers.DB, changed.ChangedBy, "UTILIZADOR_"+changed.Action, details); err != nil {
+		log.Printf("Erro ao registar alteração do utilizador %s: %v", changed.User.Username, err)
+	}
+}
+
+func auditSLAAlertChange(changed events.SLAAlertChanged) {
+	if changed.ChangedBy.Username != "" {
+		return // Já registado na transação do reconhecimento ou da resolução
+	}
+
+	alert := changed.Alert
+	var action, details string
+	switch changed.Event {
+	case SLAEventOpened:
+		action = "ALERTA_SLA_ABERTO"
+		details = fmt.Sprintf("Alerta de SLA %s aberto para a gaiola %s no buffer %s (rua %s)", alert.Level, alert.TrackingID, alert.Buffer, alert.Rua)
+	case SLAEventEscalated:
+		action = "ALERTA_SLA_ESCALADO"
+		details = fmt.Sprintf("Alerta de SLA da gaiola %s no buffer %s escalado para %s", alert.TrackingID, alert.Buffer, alert.Level)
+	case SLAEventResolved:
+		action = "ALERTA_SLA_RESOLVIDO"
+		details = fmt.Sprintf("Alerta de SLA da gaiola %s no buffer %s resolvido automaticamente: %s", alert.TrackingID, alert.Buffer, alert.Resolution)
+	default:
+		return
+	}
+
+	if err := CreateAuditLog(initializers.DB, SystemUser, action, details); err != nil {
+		log.Printf("Erro ao registar alteração do alerta de SLA #%d: %v", alert.ID, err)
+	}
+}
+
+func auditAlertRuleChange(changed events.AlertRuleChanged) {
+	record := changed.Record
+	action := "REGRA_ALERTA_DISPARADA"
+	if record.State == AlertRuleStateResolved {
+		action = "REGRA_ALERTA_NORMALIZADA"
+	}
+	if err := CreateAuditLog(initializers.DB, SystemUser, action, fmt.Sprintf("Regra %s: %s", record.RuleName, record.Message)); err != nil {
+		log.Printf("Erro ao registar evento da regra de alerta %s: %v", record.RuleName, err)
+	}
+}
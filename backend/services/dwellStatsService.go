@@ -0,0 +1,190 @@
+// backend/services/dwellStatsService.go
+package services
+
+import (
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DwellSample é o mínimo necessário para calcular a permanência de uma gaiola ativa.
+type DwellSample struct {
+	TrackingID     string
+	EntryTimestamp time.Time
+}
+
+// DwellStats resume a distribuição do tempo de permanência (em segundos) num buffer.
+// A média sozinha esconde uma gaiola esquecida; os percentis e o máximo não.
+type DwellStats struct {
+	P50              float64 `json:"p50"`
+	P90              float64 `json:"p90"`
+	P99              float64 `json:"p99"`
+	Max              float64 `json:"max"`
+	OldestTrackingID string  `json:"oldestTrackingId"`
+	SLASeconds       float64 `json:"slaSeconds"` // 0 quando não há limite configurado
+	OverSLA          int64   `json:"overSla"`    // Gaiolas acima do limite
+}
+
+// percentile devolve o percentil p (0-100) de valores já ordenados, pelo método nearest-rank.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// DwellSLAThreshold devolve o limite de permanência do buffer (0 se não houver): o limite
+// crítico da regra de SLA geral do buffer ou, na falta dela, o valor de DWELL_SLA_THRESHOLDS.
+func DwellSLAThreshold(db *gorm.DB, buffer string) time.Duration {
+	var rule models.SLARule
+	err := db.Where("buffer = ? AND profile = ? AND active = ?", buffer, "", true).Limit(1).Find(&rule).Error
+	if err == nil && rule.ID != 0 && rule.CriticalMinutes > 0 {
+		return time.Duration(rule.CriticalMinutes) * time.Minute
+	}
+	return config.AppConfig.DwellSLAThresholds[buffer]
+}
+
+// ComputeDwellStats calcula percentis, máximo e contagem acima do SLA para as gaiolas indicadas.
+func ComputeDwellStats(samples []DwellSample, now time.Time, sla time.Duration) DwellStats {
+	stats := DwellStats{SLASeconds: sla.Seconds()}
+
+	durations := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		if sample.EntryTimestamp.IsZero() {
+			continue
+		}
+		seconds := now.Sub(sample.EntryTimestamp).Seconds()
+		if seconds < 0 {
+			seconds = 0
+		}
+		durations = append(durations, seconds)
+		if seconds >= stats.Max {
+			stats.Max = seconds
+			stats.OldestTrackingID = sample.TrackingID
+		}
+		if sla > 0 && seconds > stats.SLASeconds {
+			stats.OverSLA++
+		}
+	}
+
+	sort.Float64s(durations)
+	stats.P50 = percentile(durations, 50)
+	stats.P90 = percentile(durations, 90)
+	stats.P99 = percentile(durations, 99)
+	return stats
+}
+
+// DwellBucket é uma faixa do histograma de permanência das gaiolas que já saíram.
+type DwellBucket struct {
+	Label      string  `json:"label"`
+	MaxSeconds float64 `json:"maxSeconds"` // 0 na última faixa (sem limite)
+	Count      int64   `json:"count"`
+}
+
+// HistoricalDwell é a distribuição de permanência das gaiolas que saíram de um buffer.
+type HistoricalDwell struct {
+	Count     int64         `json:"count"`
+	Avg       float64       `json:"avg"`
+	P50       float64       `json:"p50"`
+	P90       float64       `json:"p90"`
+	P99       float64       `json:"p99"`
+	Max       float64       `json:"max"`
+	Histogram []DwellBucket `json:"histogram"`
+}
+
+// dwellHistogramEdges são os limites superiores das faixas do histograma.
+var dwellHistogramEdges = []struct {
+	label string
+	limit time.Duration
+}{
+	{"<15m", 15 * time.Minute},
+	{"15m-30m", 30 * time.Minute},
+	{"30m-1h", time.Hour},
+	{"1h-2h", 2 * time.Hour},
+	{"2h-4h", 4 * time.Hour},
+	{"4h-8h", 8 * time.Hour},
+	{"8h-24h", 24 * time.Hour},
+}
+
+// GetHistoricalDwell calcula, por buffer, a distribuição da permanência das gaiolas
+// que saíram entre from e to, a partir dos PackageEvent de SAIDA. Os percentis e o histograma
+// são calculados no Postgres, para não carregar todas as saídas do período em memória.
+func GetHistoricalDwell(from, to time.Time, buffer string) (map[string]HistoricalDwell, error) {
+	exits := func() *gorm.DB {
+		query := initializers.DB.Model(&models.PackageEvent{}).
+			Where("type = ? AND dwell_seconds IS NOT NULL AND occurred_at >= ? AND occurred_at < ?", "SAIDA", from, to)
+		if buffer != "" {
+			query = query.Where("buffer = ?", buffer)
+		}
+		return query
+	}
+
+	var summaries []struct {
+		Buffer string
+		Count  int64
+		Avg    float64
+		P50    float64
+		P90    float64
+		P99    float64
+		Max    float64
+	}
+	if err := exits().Select(`buffer, COUNT(*) AS count, AVG(dwell_seconds) AS avg,
+		percentile_cont(0.5) WITHIN GROUP (ORDER BY dwell_seconds) AS p50,
+		percentile_cont(0.9) WITHIN GROUP (ORDER BY dwell_seconds) AS p90,
+		percentile_cont(0.99) WITHIN GROUP (ORDER BY dwell_seconds) AS p99,
+		MAX(dwell_seconds) AS max`).
+		Group("buffer").Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+
+	// width_bucket devolve quantos limites são <= à permanência, isto é, o índice da faixa
+	// (0 para "<15m", len(dwellHistogramEdges) para ">24h").
+	limits := make([]string, len(dwellHistogramEdges))
+	for i, edge := range dwellHistogramEdges {
+		limits[i] = strconv.FormatFloat(edge.limit.Seconds(), 'f', -1, 64)
+	}
+	bucketExpr := "width_bucket(dwell_seconds, ARRAY[" + strings.Join(limits, ",") + "]::double precision[])"
+	var buckets []struct {
+		Buffer string
+		Bucket int
+		Count  int64
+	}
+	if err := exits().Select("buffer, " + bucketExpr + " AS bucket, COUNT(*) AS count").
+		Group("buffer, bucket").Scan(&buckets).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]HistoricalDwell, len(summaries))
+	for _, summary := range summaries {
+		dist := HistoricalDwell{
+			Count: summary.Count,
+			Avg:   summary.Avg,
+			P50:   summary.P50,
+			P90:   summary.P90,
+			P99:   summary.P99,
+			Max:   summary.Max,
+		}
+		for _, edge := range dwellHistogramEdges {
+			dist.Histogram = append(dist.Histogram, DwellBucket{Label: edge.label, MaxSeconds: edge.limit.Seconds()})
+		}
+		dist.Histogram = append(dist.Histogram, DwellBucket{Label: ">24h"})
+		result[summary.Buffer] = dist
+	}
+	for _, bucket := range buckets {
+		if dist, ok := result[bucket.Buffer]; ok && bucket.Bucket >= 0 && bucket.Bucket < len(dist.Histogram) {
+			dist.Histogram[bucket.Bucket].Count += bucket.Count
+		}
+	}
+	return result, nil
+}
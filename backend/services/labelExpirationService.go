@@ -0,0 +1,79 @@
+// backend/services/labelExpirationService.go
+package services
+
+import (
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SystemUser identifica as ações automáticas (tarefas em segundo plano) nos logs de auditoria.
+var SystemUser = models.User{Username: "sistema", FullName: "Sistema"}
+
+// ExpireStaleLabels marca como EXPIRADO as etiquetas PENDENTE criadas (ou reativadas) há mais
+// de maxAge e grava um LabelExpirationRun com o relatório do que foi expirado.
+func ExpireStaleLabels(maxAge time.Duration, triggeredBy models.User) (models.LabelExpirationRun, error) {
+	now := GetBrasiliaTime()
+	run := models.LabelExpirationRun{
+		Cutoff:      now.Add(-maxAge),
+		TriggeredBy: triggeredBy.Username,
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Um único UPDATE com a condição completa: uma etiqueta que dê entrada num buffer
+		// durante a expiração deixa de ser PENDENTE e já não é apanhada.
+		// Tal como nas etiquetas anuladas, o soft delete retira-as das consultas da fila.
+		var expired []models.Package
+		updates := map[string]interface{}{
+			"Buffer":    "EXPIRADO",
+			"ExpiredAt": now,
+			"DeletedAt": now,
+		}
+		if err := tx.Model(&expired).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "tracking_id"}}}).
+			Where("buffer = ? AND COALESCE(reactivated_at, created_at) < ?", "PENDENTE", run.Cutoff).
+			Updates(updates).Error; err != nil {
+			return fmt.Errorf("falha ao expirar etiquetas: %w", err)
+		}
+
+		expiredIDs := make([]string, 0, len(expired))
+		for _, pkg := range expired {
+			expiredIDs = append(expiredIDs, pkg.TrackingID)
+		}
+		sort.Strings(expiredIDs)
+		run.ExpiredCount = len(expiredIDs)
+		run.TrackingIDs = strings.Join(expiredIDs, ",")
+
+		if len(expiredIDs) > 0 {
+			logDetails := fmt.Sprintf("%d etiquetas pendentes criadas antes de %s foram expiradas", len(expiredIDs), run.Cutoff.Format("02/01/2006 15:04"))
+			if err := CreateAuditLog(tx, triggeredBy, "EXPIRACAO_ETIQUETAS", logDetails); err != nil {
+				return err
+			}
+		}
+
+		// Execuções automáticas sem etiquetas expiradas não geram relatório.
+		if run.ExpiredCount == 0 && triggeredBy.Username == SystemUser.Username {
+			return nil
+		}
+		return tx.Create(&run).Error
+	})
+
+	return run, err
+}
+
+// ExpireStaleLabelsJob é a tarefa agendada "expirar-etiquetas", registada em main
+// com o intervalo de LABEL_EXPIRATION_INTERVAL.
+func ExpireStaleLabelsJob() (string, error) {
+	run, err := ExpireStaleLabels(config.AppConfig.LabelExpirationAge, SystemUser)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d etiquetas expiradas", run.ExpiredCount), nil
+}
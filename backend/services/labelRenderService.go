@@ -0,0 +1,349 @@
+// backend/services/labelRenderService.go
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	DefaultLabelWidthMM  = 50.0
+	DefaultLabelHeightMM = 50.0
+	DefaultLabelDPI      = 203 // Resolução padrão das impressoras Zebra
+	DefaultLabelCaption  = "STAGE IN"
+
+	mmPerInch = 25.4
+)
+
+// LabelOptions define o tamanho físico da etiqueta e a legenda legível opcional,
+// partilhado por todos os formatos de saída (PDF, PNG e ZPL).
+type LabelOptions struct {
+	WidthMM     float64
+	HeightMM    float64
+	DPI         int
+	ShowCaption bool   // Imprime o TrackingID por baixo do QR Code
+	Caption     string // Segunda linha da legenda (por omissão "STAGE IN")
+}
+
+// Normalize preenche os valores por omissão e valida os limites aceites.
+func (o *LabelOptions) Normalize() error {
+	if o.WidthMM == 0 {
+		o.WidthMM = DefaultLabelWidthMM
+	}
+	if o.HeightMM == 0 {
+		o.HeightMM = DefaultLabelHeightMM
+	}
+	if o.DPI == 0 {
+		o.DPI = DefaultLabelDPI
+	}
+	if o.ShowCaption && strings.TrimSpace(o.Caption) == "" {
+		o.Caption = DefaultLabelCaption
+	}
+	if o.WidthMM < 20 || o.WidthMM > 150 || o.HeightMM < 20 || o.HeightMM > 150 {
+		return fmt.Errorf("o tamanho da etiqueta deve estar entre 20 e 150 mm")
+	}
+	if o.DPI < 100 || o.DPI > 600 {
+		return fmt.Errorf("a resolução deve estar entre 100 e 600 dpi")
+	}
+	return nil
+}
+
+func mmToDots(mm float64, dpi int) int {
+	return int(math.Round(mm / mmPerInch * float64(dpi)))
+}
+
+// captionHeightRatio é a fração da altura da etiqueta reservada à legenda.
+const captionHeightRatio = 0.28
+
+// RenderLabelPNG desenha uma única etiqueta (QR Code e legenda opcional) como PNG,
+// com as dimensões em píxeis calculadas a partir do tamanho em mm e do DPI.
+func RenderLabelPNG(trackingID string, opts LabelOptions) ([]byte, error) {
+	width := mmToDots(opts.WidthMM, opts.DPI)
+	height := mmToDots(opts.HeightMM, opts.DPI)
+
+	qrArea := height
+	if opts.ShowCaption {
+		qrArea = int(float64(height) * (1 - captionHeightRatio))
+	}
+	if width < qrArea {
+		qrArea = width
+	}
+
+	qr, err := qrcode.New(trackingID, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao gerar QR Code para %s: %w", trackingID, err)
+	}
+	qrImg := qr.Image(qrArea)
+
+	label := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(label, label.Bounds(), image.White, image.Point{}, draw.Src)
+	qrOffset := image.Pt((width-qrImg.Bounds().Dx())/2, 0)
+	draw.Draw(label, qrImg.Bounds().Add(qrOffset), qrImg, image.Point{}, draw.Src)
+
+	if opts.ShowCaption {
+		captionTop := qrImg.Bounds().Dy()
+		lineHeight := (height - captionTop) / 2
+		drawCaptionLine(label, trackingID, captionTop, lineHeight)
+		drawCaptionLine(label, opts.Caption, captionTop+lineHeight, lineHeight)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, label); err != nil {
+		return nil, fmt.Errorf("falha ao codificar PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawCaptionLine escreve uma linha centrada com a fonte bitmap 7x13, ampliada
+// por um fator inteiro para ocupar a altura disponível.
+func drawCaptionLine(dst *image.RGBA, text string, top, lineHeight int) {
+	face := basicfont.Face7x13
+	textWidth := font.MeasureString(face, text).Ceil()
+	if textWidth == 0 {
+		return
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, textWidth, face.Height))
+	draw.Draw(small, small.Bounds(), image.White, image.Point{}, draw.Src)
+	d := &font.Drawer{
+		Dst:  small,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	d.DrawString(text)
+
+	scale := lineHeight / face.Height
+	if maxScale := dst.Bounds().Dx() / textWidth; maxScale < scale {
+		scale = maxScale
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	left := (dst.Bounds().Dx() - textWidth*scale) / 2
+	top += (lineHeight - face.Height*scale) / 2
+	for y := 0; y < face.Height; y++ {
+		for x := 0; x < textWidth; x++ {
+			if small.RGBAAt(x, y) == (color.RGBA{255, 255, 255, 255}) {
+				continue
+			}
+			rect := image.Rect(left+x*scale, top+y*scale, left+(x+1)*scale, top+(y+1)*scale)
+			draw.Draw(dst, rect, image.Black, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// RenderLabelsPNGZip gera um PNG por TrackingID e agrupa-os num arquivo ZIP.
+func RenderLabelsPNGZip(trackingIDs []string, opts LabelOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, id := range trackingIDs {
+		data, err := RenderLabelPNG(id, opts)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zw.Create(id + ".png")
+		if err != nil {
+			return nil, fmt.Errorf("falha ao criar entrada no ZIP: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("falha ao escrever entrada no ZIP: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("falha ao finalizar ZIP: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderLabelsPDF distribui as etiquetas numa folha A4 (em grelha, com margem de 10 mm),
+// desenhando os módulos do QR Code como vetores para impressão nítida.
+func RenderLabelsPDF(trackingIDs []string, opts LabelOptions) ([]byte, error) {
+	const (
+		pageWidth  = 210.0
+		pageHeight = 297.0
+		margin     = 10.0
+	)
+
+	cols := int((pageWidth - 2*margin) / opts.WidthMM)
+	rows := int((pageHeight - 2*margin) / opts.HeightMM)
+	if cols < 1 || rows < 1 {
+		return nil, fmt.Errorf("a etiqueta não cabe numa folha A4")
+	}
+	perPage := cols * rows
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetFillColor(0, 0, 0)
+	pdf.SetDrawColor(200, 200, 200)
+	// As fontes base do PDF usam cp1252; converte a legenda para suportar acentos.
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	for i, id := range trackingIDs {
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+		pos := i % perPage
+		x := margin + float64(pos%cols)*opts.WidthMM
+		y := margin + float64(pos/cols)*opts.HeightMM
+
+		// Linha de corte à volta de cada etiqueta
+		pdf.Rect(x, y, opts.WidthMM, opts.HeightMM, "D")
+
+		qr, err := qrcode.New(id, qrcode.Medium)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao gerar QR Code para %s: %w", id, err)
+		}
+		bitmap := qr.Bitmap()
+
+		qrSide := opts.HeightMM
+		if opts.ShowCaption {
+			qrSide = opts.HeightMM * (1 - captionHeightRatio)
+		}
+		if opts.WidthMM < qrSide {
+			qrSide = opts.WidthMM
+		}
+		module := qrSide / float64(len(bitmap))
+		qrX := x + (opts.WidthMM-qrSide)/2
+		for row, line := range bitmap {
+			for col, dark := range line {
+				if dark {
+					pdf.Rect(qrX+float64(col)*module, y+float64(row)*module, module, module, "F")
+				}
+			}
+		}
+
+		if opts.ShowCaption {
+			lineHeight := (opts.HeightMM - qrSide) / 2
+			fontSize := lineHeight * 2.2 // mm -> pt, com folga para o espaçamento
+			pdf.SetXY(x, y+qrSide)
+			pdf.SetFont("Helvetica", "B", fontSize)
+			pdf.CellFormat(opts.WidthMM, lineHeight, tr(id), "", 2, "C", false, 0, "")
+			pdf.SetX(x)
+			pdf.SetFont("Helvetica", "", fontSize*0.8)
+			pdf.CellFormat(opts.WidthMM, lineHeight, tr(opts.Caption), "", 0, "C", false, 0, "")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("falha ao gerar PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderLabelsZPL gera um formato ^XA...^XZ por etiqueta. O QR Code é desenhado pela
+// própria impressora (^BQ), com a ampliação calculada para o espaço disponível.
+func RenderLabelsZPL(trackingIDs []string, opts LabelOptions) ([]byte, error) {
+	width := mmToDots(opts.WidthMM, opts.DPI)
+	height := mmToDots(opts.HeightMM, opts.DPI)
+
+	qrArea := height
+	if opts.ShowCaption {
+		qrArea = int(float64(height) * (1 - captionHeightRatio))
+	}
+	if width < qrArea {
+		qrArea = width
+	}
+
+	var b strings.Builder
+	for _, id := range trackingIDs {
+		qr, err := qrcode.New(id, qrcode.Medium)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao gerar QR Code para %s: %w", id, err)
+		}
+		// O bitmap inclui a zona de silêncio, tal como o espaço reservado na etiqueta.
+		magnification := qrArea / len(qr.Bitmap())
+		if magnification < 1 {
+			magnification = 1
+		}
+		if magnification > 10 {
+			magnification = 10
+		}
+		qrSide := magnification * len(qr.Bitmap())
+
+		b.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(&b, "^PW%d\n^LL%d\n", width, height)
+		quietZone := 4 * magnification
+		fmt.Fprintf(&b, "^FO%d,%d^BQN,2,%d^FDMA,%s^FS\n", (width-qrSide)/2+quietZone, quietZone, magnification, zplEscape(id))
+		if opts.ShowCaption {
+			lineHeight := (height - qrSide) / 2
+			fontHeight := lineHeight * 8 / 10
+			fmt.Fprintf(&b, "^FO0,%d^A0N,%d,%d^FB%d,1,0,C^FD%s^FS\n", qrSide, fontHeight, fontHeight, width, zplEscape(id))
+			fmt.Fprintf(&b, "^FO0,%d^A0N,%d,%d^FB%d,1,0,C^FD%s^FS\n", qrSide+lineHeight, fontHeight*8/10, fontHeight*8/10, width, zplEscape(opts.Caption))
+		}
+		b.WriteString("^XZ\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// RenderLabelsEPL gera o equivalente EPL2 de RenderLabelsZPL, para impressoras
+// Zebra/Eltron mais antigas que não interpretam ZPL. O QR Code usa o comando "b".
+func RenderLabelsEPL(trackingIDs []string, opts LabelOptions) ([]byte, error) {
+	width := mmToDots(opts.WidthMM, opts.DPI)
+	height := mmToDots(opts.HeightMM, opts.DPI)
+
+	qrArea := height
+	if opts.ShowCaption {
+		qrArea = int(float64(height) * (1 - captionHeightRatio))
+	}
+	if width < qrArea {
+		qrArea = width
+	}
+
+	var b strings.Builder
+	for _, id := range trackingIDs {
+		qr, err := qrcode.New(id, qrcode.Medium)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao gerar QR Code para %s: %w", id, err)
+		}
+		scale := qrArea / len(qr.Bitmap())
+		if scale < 1 {
+			scale = 1
+		}
+		qrSide := scale * len(qr.Bitmap())
+		quietZone := 4 * scale
+
+		b.WriteString("\nN\n")
+		fmt.Fprintf(&b, "q%d\nQ%d,24\n", width, height)
+		fmt.Fprintf(&b, "b%d,%d,Q,m2,s%d,eM,\"%s\"\n", (width-qrSide)/2+quietZone, quietZone, scale, eplEscape(id))
+		if opts.ShowCaption {
+			// Fonte 4 (24 pontos de altura a 203 dpi), ampliada para a linha disponível.
+			lineHeight := (height - qrSide) / 2
+			mult := lineHeight / 28
+			if mult < 1 {
+				mult = 1
+			}
+			for i, text := range []string{id, opts.Caption} {
+				textWidth := len([]rune(text)) * 14 * mult
+				fmt.Fprintf(&b, "A%d,%d,0,4,%d,%d,N,\"%s\"\n", max((width-textWidth)/2, 0), qrSide+i*lineHeight, mult, mult, eplEscape(text))
+			}
+		}
+		b.WriteString("P1\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// eplEscape escapa aspas e barras invertidas dentro dos campos de texto EPL.
+func eplEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// zplEscape remove os caracteres de controlo do ZPL (^ e ~) do conteúdo dos campos.
+func zplEscape(s string) string {
+	return strings.NewReplacer("^", "", "~", "").Replace(s)
+}
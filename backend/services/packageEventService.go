@@ -0,0 +1,37 @@
+// backend/services/packageEventService.go
+package services
+
+import (
+	"fifo-system/backend/models"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// RecordPackageEvent grava um PackageEvent a partir do estado do pacote. Deve ser chamado
+// dentro da mesma transação que altera o pacote e cria o AuditLog.
+func RecordPackageEvent(tx *gorm.DB, user models.User, eventType string, pkg models.Package, fromRua string) (models.PackageEvent, error) {
+	event := models.PackageEvent{
+		OccurredAt:   GetBrasiliaTime(),
+		Type:         eventType,
+		PackageID:    pkg.ID,
+		TrackingID:   pkg.TrackingID,
+		Scheme:       pkg.Scheme,
+		Buffer:       pkg.Buffer,
+		Rua:          pkg.Rua,
+		FromRua:      fromRua,
+		Profile:      pkg.Profile,
+		ProfileValue: pkg.ProfileValue,
+		UserID:       user.ID,
+		Username:     user.Username,
+	}
+	if eventType == "SAIDA" && !pkg.EntryTimestamp.IsZero() {
+		dwell := event.OccurredAt.Sub(pkg.EntryTimestamp).Seconds()
+		event.DwellSeconds = &dwell
+	}
+
+	if err := tx.Create(&event).Error; err != nil {
+		return event, fmt.Errorf("failed to create package event: %w", err)
+	}
+	return event, nil
+}
@@ -0,0 +1,341 @@
+// backend/services/packageService.go
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/events"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// As operações da fila (entrada, saída, movimentação e leitura) são partilhadas pelas
+// rotas HTTP (packageController.go) e pelos comandos do WebSocket. Cada operação
+// concluída publica o respetivo evento no barramento depois do commit.
+
+// PackageError é um erro de uma operação da fila que deve chegar ao utilizador,
+// com o código HTTP correspondente. Os restantes erros são internos.
+type PackageError struct {
+	Status  int
+	Message string
+}
+
+func (e *PackageError) Error() string { return e.Message }
+
+func packageError(status int, format string, args ...interface{}) *PackageError {
+	return &PackageError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// profileValues são os valores de cada perfil de pacote no backlog.
+var profileValues = map[string]int{"P": 250, "M": 80, "G": 10}
+
+// PackageEntryInput são os dados de uma entrada na fila. Profile é obrigatório fora do buffer SAL.
+type PackageEntryInput struct {
+	TrackingID string `json:"trackingId" binding:"required"`
+	Buffer     string `json:"buffer" binding:"required"`
+	Rua        string `json:"rua" binding:"required"`
+	Profile    string `json:"profile"` // Perfil é opcional no bind
+}
+
+// resolvePackageTrackingID recusa IDs fora dos esquemas ativos (ou com dígito verificador errado)
+// antes de qualquer alteração na fila, e devolve o nome do esquema a que o ID pertence.
+func resolvePackageTrackingID(trackingID string) (string, error) {
+	scheme, err := ResolveTrackingID(initializers.DB, trackingID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCheckDigit) || errors.Is(err, ErrUnknownScheme) {
+			return "", &PackageError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		return "", fmt.Errorf("erro ao validar TrackingID %s: %w", trackingID, err)
+	}
+	return scheme, nil
+}
+
+// EnterPackage coloca uma gaiola na fila, reativando o registo se o TrackingID já existiu.
+func EnterPackage(user models.User, input PackageEntryInput) (models.Package, error) {
+	var profileValue int
+	var profileCode string = "N/A" // Padrão
+
+	if input.Buffer != "SAL" {
+		if input.Profile == "" {
+			return models.Package{}, packageError(http.StatusBadRequest, "Perfil é obrigatório para buffers RTS e EHA.")
+		}
+		value, ok := profileValues[input.Profile]
+		if !ok {
+			return models.Package{}, packageError(http.StatusBadRequest, "Perfil inválido. Use 'P', 'M', ou 'G'.")
+		}
+		profileValue, profileCode = value, input.Profile
+	}
+
+	scheme, err := resolvePackageTrackingID(input.TrackingID)
+	if err != nil {
+		return models.Package{}, err
+	}
+
+	var (
+		entered models.Package // Estado final do pacote, publicado em PackageEntered
+		event   models.PackageEvent
+	)
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var pkg models.Package
+		// Usar Unscoped para encontrar mesmo se existir mas estiver "deletado" (soft delete)
+		// Isso evita criar um ID duplicado se ele já existiu antes.
+		// O bloqueio da linha impede que a expiração ou a anulação da etiqueta aconteçam entre
+		// esta leitura e a atualização abaixo (uma etiqueta expirada seria reativada sem querer).
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("tracking_id = ?", input.TrackingID).First(&pkg).Error
+
+		currentTime := GetBrasiliaTime()
+
+		// Cenário 1: Pacote NUNCA existiu
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			newPackage := models.Package{
+				TrackingID:     input.TrackingID,
+				Buffer:         input.Buffer,
+				Rua:            input.Rua,
+				EntryTimestamp: currentTime,
+				Profile:        profileCode,
+				ProfileValue:   profileValue,
+				Scheme:         scheme,
+				// gorm.Model já inclui CreatedAt, UpdatedAt. DeletedAt será NULL.
+			}
+			if err := tx.Create(&newPackage).Error; err != nil {
+				return fmt.Errorf("falha ao criar novo pacote: %w", err)
+			}
+			entered = newPackage
+			// Cenário 2: Pacote JÁ EXISTE
+		} else if err == nil {
+			// Etiquetas anuladas (folhas perdidas) nunca podem voltar a entrar na fila.
+			if pkg.Buffer == "ANULADO" {
+				return packageError(http.StatusConflict, "o código %s foi anulado e não pode ser utilizado", pkg.TrackingID)
+			}
+			// Etiquetas expiradas só podem entrar depois de reativadas por um líder.
+			if pkg.Buffer == "EXPIRADO" {
+				return packageError(http.StatusConflict, "a etiqueta %s expirou por não ter sido utilizada e precisa de ser reativada", pkg.TrackingID)
+			}
+			// Sub-cenário 2.1: Pacote existe e está ATIVO na fila (Buffer não PENDENTE e DeletedAt é NULL)
+			if pkg.Buffer != "PENDENTE" && pkg.DeletedAt.Valid == false {
+				return packageError(http.StatusConflict, "o item %s já se encontra na fila (Buffer: %s, Rua: %s)", pkg.TrackingID, pkg.Buffer, pkg.Rua)
+			}
+			// Sub-cenário 2.2: Pacote existe mas está como PENDENTE ou foi DELETADO (soft delete)
+			// Podemos "reativá-lo" ou atualizar seu estado de PENDENTE para ativo.
+			updates := map[string]interface{}{
+				"Buffer":         input.Buffer,
+				"Rua":            input.Rua,
+				"EntryTimestamp": currentTime,
+				"Profile":        profileCode,
+				"ProfileValue":   profileValue,
+				"Scheme":         scheme,
+				"DeletedAt":      nil, // Garante que o soft delete seja removido se existir
+			}
+			// Usar Unscoped aqui também para garantir que atualizamos mesmo se estiver deletado
+			if err := tx.Unscoped().Model(&pkg).Where("tracking_id = ?", input.TrackingID).Updates(updates).Error; err != nil {
+				return fmt.Errorf("falha ao atualizar pacote existente: %w", err)
+			}
+			entered = pkg
+			entered.Buffer, entered.Rua, entered.EntryTimestamp = input.Buffer, input.Rua, currentTime
+			entered.Profile, entered.ProfileValue, entered.Scheme = profileCode, profileValue, scheme
+			entered.DeletedAt = gorm.DeletedAt{}
+			// Cenário 3: Outro erro de banco de dados
+		} else {
+			return fmt.Errorf("erro ao buscar pacote: %w", err)
+		}
+
+		logDetails := ""
+		if profileCode != "N/A" {
+			logDetails = fmt.Sprintf("A Gaiola %s perfil de pacote %s entrou no buffer %s na rua %s", input.TrackingID, profileCode, input.Buffer, input.Rua)
+		} else {
+			logDetails = fmt.Sprintf("A Gaiola %s entrou no buffer %s na rua %s", input.TrackingID, input.Buffer, input.Rua)
+		}
+		if err := CreateAuditLog(tx, user, "ENTRADA", logDetails); err != nil {
+			return err // Erro já vem formatado do service
+		}
+		recorded, err := RecordPackageEvent(tx, user, "ENTRADA", entered, "")
+		if err != nil {
+			return err
+		}
+		event = recorded
+
+		return nil
+	})
+	if err != nil {
+		return models.Package{}, err
+	}
+
+	events.B.Publish(events.PackageEntered{Package: entered, Record: event})
+	return entered, nil
+}
+
+// ExitPackage retira uma gaiola ativa da fila (soft delete).
+func ExitPackage(user models.User, trackingID string) (models.Package, error) {
+	if _, err := resolvePackageTrackingID(trackingID); err != nil {
+		return models.Package{}, err
+	}
+
+	var (
+		exited models.Package
+		event  models.PackageEvent
+	)
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var pkg models.Package
+		// Busca apenas pacotes ATIVOS (não deletados)
+		if err := tx.Where("tracking_id = ?", trackingID).First(&pkg).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return packageError(http.StatusNotFound, "Item não encontrado na fila ativa.")
+			}
+			return fmt.Errorf("erro ao buscar pacote para saída: %w", err)
+		}
+
+		// Itens PENDENTES não deveriam estar ativos, mas checamos por segurança.
+		if pkg.Buffer == "PENDENTE" {
+			return packageError(http.StatusConflict, "este item está como pendente e não pode ser removido pela saída normal")
+		}
+
+		logDetails := ""
+		if pkg.Profile != "N/A" {
+			logDetails = fmt.Sprintf("A Gaiola %s perfil de pacote %s foi removida do buffer %s na rua %s", pkg.TrackingID, pkg.Profile, pkg.Buffer, pkg.Rua)
+		} else {
+			logDetails = fmt.Sprintf("A Gaiola %s foi removida do buffer %s na rua %s", pkg.TrackingID, pkg.Buffer, pkg.Rua)
+		}
+		if err := CreateAuditLog(tx, user, "SAIDA", logDetails); err != nil {
+			return err
+		}
+		recorded, err := RecordPackageEvent(tx, user, "SAIDA", pkg, "")
+		if err != nil {
+			return err
+		}
+		exited, event = pkg, recorded
+
+		// Soft Delete padrão do GORM
+		if err := tx.Delete(&pkg).Error; err != nil {
+			return fmt.Errorf("falha ao realizar soft delete: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.Package{}, err
+	}
+
+	events.B.Publish(events.PackageExited{Package: exited, Record: event})
+	return exited, nil
+}
+
+// MovePackage muda uma gaiola ativa de rua. A gaiola é procurada pelo ID ou, se packageID
+// for 0, pelo TrackingID. Devolve moved=false quando a gaiola já estava na rua indicada.
+func MovePackage(user models.User, packageID uint, trackingID string, rua string) (pkg models.Package, moved bool, err error) {
+	var (
+		fromRua string
+		event   models.PackageEvent
+	)
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Busca pacote ativo pelo ID numérico ou pelo TrackingID
+		query := tx
+		if packageID != 0 {
+			query = query.Where("id = ?", packageID)
+		} else {
+			query = query.Where("tracking_id = ?", trackingID)
+		}
+		if err := query.First(&pkg).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return packageError(http.StatusNotFound, "item não encontrado ou já removido da fila")
+			}
+			return fmt.Errorf("erro ao buscar pacote para mover: %w", err)
+		}
+
+		oldRua := pkg.Rua
+		newRua := rua
+
+		if oldRua == newRua {
+			return nil // Nenhuma alteração
+		}
+
+		if err := tx.Model(&pkg).Update("rua", newRua).Error; err != nil {
+			return fmt.Errorf("falha ao atualizar rua: %w", err)
+		}
+
+		logDetails := ""
+		if pkg.Profile != "N/A" {
+			logDetails = fmt.Sprintf("A Gaiola %s perfil de pacote %s foi movida da rua %s para %s", pkg.TrackingID, pkg.Profile, oldRua, newRua)
+		} else {
+			logDetails = fmt.Sprintf("A Gaiola %s foi movida da rua %s para %s", pkg.TrackingID, oldRua, newRua)
+		}
+		if err := CreateAuditLog(tx, user, "MOVIMENTACAO", logDetails); err != nil {
+			return err
+		}
+		pkg.Rua = newRua
+		recorded, err := RecordPackageEvent(tx, user, "MOVIMENTACAO", pkg, oldRua)
+		if err != nil {
+			return err
+		}
+		fromRua, event = oldRua, recorded
+
+		return nil
+	})
+	if err != nil {
+		return models.Package{}, false, err
+	}
+
+	if event.ID != 0 { // Sem evento quando a rua não mudou
+		events.B.Publish(events.PackageMoved{Package: pkg, FromRua: fromRua, Record: event})
+	}
+	return pkg, event.ID != 0, nil
+}
+
+// Estados devolvidos por ScanPackage.
+const (
+	ScanStatusInQueue = "NA_FILA"      // Ativa na fila: a próxima operação é a saída
+	ScanStatusOut     = "FORA_DA_FILA" // Já saiu (ou nunca entrou): pode entrar
+	ScanStatusPending = "PENDENTE"     // Etiqueta gerada e ainda não utilizada: pode entrar
+	ScanStatusVoided  = "ANULADO"
+	ScanStatusExpired = "EXPIRADO"
+)
+
+// ScanResult descreve uma gaiola lida por um scanner, para o cliente decidir a operação seguinte.
+type ScanResult struct {
+	TrackingID   string          `json:"trackingId"`
+	Scheme       string          `json:"scheme"`
+	Status       string          `json:"status"`
+	NextAction   string          `json:"nextAction,omitempty"` // ENTRADA ou SAIDA
+	Package      *models.Package `json:"package,omitempty"`
+	DwellSeconds float64         `json:"dwellSeconds,omitempty"`
+}
+
+// ScanPackage valida o TrackingID e devolve o estado atual da gaiola, sem alterar a fila.
+func ScanPackage(trackingID string) (ScanResult, error) {
+	scheme, err := resolvePackageTrackingID(trackingID)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	result := ScanResult{TrackingID: trackingID, Scheme: scheme}
+
+	var pkg models.Package
+	err = initializers.DB.Unscoped().Where("tracking_id = ?", trackingID).First(&pkg).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		result.Status, result.NextAction = ScanStatusOut, "ENTRADA"
+		return result, nil
+	case err != nil:
+		return ScanResult{}, fmt.Errorf("erro ao buscar pacote: %w", err)
+	}
+
+	switch {
+	case pkg.Buffer == "ANULADO":
+		result.Status = ScanStatusVoided
+	case pkg.Buffer == "EXPIRADO":
+		result.Status = ScanStatusExpired
+	case pkg.Buffer == "PENDENTE":
+		result.Status, result.NextAction = ScanStatusPending, "ENTRADA"
+	case pkg.DeletedAt.Valid:
+		result.Status, result.NextAction = ScanStatusOut, "ENTRADA"
+	default:
+		result.Status, result.NextAction = ScanStatusInQueue, "SAIDA"
+		result.Package = &pkg
+		if !pkg.EntryTimestamp.IsZero() {
+			result.DwellSeconds = GetBrasiliaTime().Sub(pkg.EntryTimestamp).Seconds()
+		}
+	}
+	return result, nil
+}
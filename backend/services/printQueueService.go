@@ -0,0 +1,191 @@
+// backend/services/printQueueService.go
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	printWorkers       = 4
+	printMaxAttempts   = 5
+	printBaseBackoff   = 5 * time.Second // Duplica a cada tentativa: 5s, 10s, 20s, 40s
+	printDialTimeout   = 5 * time.Second
+	printWriteTimeout  = 15 * time.Second
+	printQueueCapacity = 256
+
+	// printLease é o tempo durante o qual um trabalho ENVIANDO pertence a quem o reclamou.
+	// É bem maior do que um envio pode demorar (ligação + escrita); passado este tempo a
+	// instância que o reclamou terminou a meio e o trabalho volta a PENDENTE.
+	printLease = 2 * time.Minute
+)
+
+// printQueue envia os PrintJob para as impressoras em segundo plano,
+// com novas tentativas e backoff exponencial em caso de falha.
+type printQueue struct {
+	jobs chan uint
+}
+
+// PrintQueue é a fila global de impressão, iniciada em main com go services.PrintQueue.Run().
+var PrintQueue = &printQueue{jobs: make(chan uint, printQueueCapacity)}
+
+// Run inicia os workers e, a cada printLease, retoma os trabalhos abandonados: os ENVIANDO
+// cujo envio expirou (instância terminada a meio) e os PENDENTE que nenhuma instância tem
+// agendados. Com várias instâncias a correr, a reclamação atómica em process garante que
+// cada trabalho só é enviado uma vez.
+func (q *printQueue) Run() {
+	for i := 0; i < printWorkers; i++ {
+		go q.worker()
+	}
+
+	q.recover()
+	ticker := time.NewTicker(printLease)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.recover()
+	}
+}
+
+// recover devolve a PENDENTE os trabalhos com o envio expirado e coloca na fila os pendentes
+// cuja próxima tentativa já chegou.
+func (q *printQueue) recover() {
+	expired := initializers.DB.Model(&models.PrintJob{}).
+		Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", "ENVIANDO", GetBrasiliaTime().Add(-printLease)).
+		Updates(map[string]interface{}{"status": "PENDENTE", "claimed_at": nil})
+	if expired.Error != nil {
+		log.Printf("Erro ao retomar trabalhos de impressão interrompidos: %v", expired.Error)
+	} else if expired.RowsAffected > 0 {
+		log.Printf("%d trabalhos de impressão interrompidos voltaram a PENDENTE.", expired.RowsAffected)
+	}
+
+	// Só os que já estão para enviar: os de nova tentativa futura já têm temporizador na instância
+	// que os agendou, e se essa instância terminar um dos ticks seguintes apanha-os
+	var pending []models.PrintJob
+	if err := initializers.DB.Where("status = ? AND (next_attempt IS NULL OR next_attempt <= ?)", "PENDENTE", GetBrasiliaTime()).
+		Find(&pending).Error; err != nil {
+		log.Printf("Erro ao retomar trabalhos de impressão pendentes: %v", err)
+		return
+	}
+	for _, job := range pending {
+		q.Enqueue(job.ID)
+	}
+}
+
+// Enqueue coloca um trabalho na fila sem bloquear o pedido HTTP que o criou.
+func (q *printQueue) Enqueue(jobID uint) {
+	select {
+	case q.jobs <- jobID:
+	default:
+		go func() { q.jobs <- jobID }()
+	}
+}
+
+func (q *printQueue) enqueueAfter(jobID uint, delay time.Duration) {
+	if delay <= 0 {
+		q.Enqueue(jobID)
+		return
+	}
+	time.AfterFunc(delay, func() { q.Enqueue(jobID) })
+}
+
+func (q *printQueue) worker() {
+	for jobID := range q.jobs {
+		q.process(jobID)
+	}
+}
+
+func (q *printQueue) process(jobID uint) {
+	// Reclama o trabalho de forma atómica, para que nunca seja enviado duas vezes em paralelo.
+	claim := initializers.DB.Model(&models.PrintJob{}).
+		Where("id = ? AND status = ?", jobID, "PENDENTE").
+		Updates(map[string]interface{}{"status": "ENVIANDO", "attempts": gorm.Expr("attempts + 1"), "claimed_at": GetBrasiliaTime()})
+	if claim.Error != nil {
+		log.Printf("Erro ao reclamar trabalho de impressão #%d: %v", jobID, claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return // Já concluído, falhado ou a ser enviado por outro worker
+	}
+
+	var job models.PrintJob
+	if err := initializers.DB.Preload("Printer").First(&job, jobID).Error; err != nil {
+		log.Printf("Erro ao carregar trabalho de impressão #%d: %v", jobID, err)
+		return
+	}
+
+	var sendErr error
+	if job.Printer.ID == 0 {
+		// A impressora foi removida depois de o trabalho ser criado
+		sendErr = errPrinterRemoved
+	} else {
+		address := net.JoinHostPort(job.Printer.Host, strconv.Itoa(job.Printer.Port))
+		sendErr = SendToPrinter(address, []byte(job.Payload))
+	}
+
+	var retryIn time.Duration
+	updates := map[string]interface{}{"claimed_at": nil}
+	switch {
+	case sendErr == nil:
+		now := GetBrasiliaTime()
+		updates["status"] = "CONCLUIDO"
+		updates["completed_at"] = now
+		updates["last_error"] = ""
+		updates["next_attempt"] = nil
+		log.Printf("Trabalho de impressão #%d enviado para %s (%d etiquetas).", job.ID, job.Printer.Name, job.LabelCount)
+	case job.Attempts >= printMaxAttempts || sendErr == errPrinterRemoved:
+		updates["status"] = "FALHOU"
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt"] = nil
+		log.Printf("Trabalho de impressão #%d falhou definitivamente após %d tentativas: %v", job.ID, job.Attempts, sendErr)
+	default:
+		retryIn = printBackoff(job.Attempts)
+		updates["status"] = "PENDENTE"
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt"] = GetBrasiliaTime().Add(retryIn)
+		log.Printf("Falha no trabalho de impressão #%d (tentativa %d), nova tentativa em %s: %v", job.ID, job.Attempts, retryIn, sendErr)
+	}
+
+	if err := initializers.DB.Model(&models.PrintJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("Erro ao atualizar estado do trabalho de impressão #%d: %v", job.ID, err)
+		return
+	}
+	if retryIn > 0 {
+		q.enqueueAfter(job.ID, retryIn)
+	}
+}
+
+// PrinterRemovedError é a mensagem gravada nos trabalhos cuja impressora foi removida antes do envio.
+const PrinterRemovedError = "Impressora removida antes do envio."
+
+// errPrinterRemoved falha o trabalho sem novas tentativas.
+var errPrinterRemoved = errors.New(PrinterRemovedError)
+
+// printBackoff é a espera antes da tentativa seguinte à tentativa attempt (a primeira é 1).
+func printBackoff(attempt int) time.Duration {
+	return printBaseBackoff * time.Duration(1<<(attempt-1))
+}
+
+// SendToPrinter abre um socket TCP bruto (porta 9100 por omissão) e envia o conteúdo tal como está.
+func SendToPrinter(address string, payload []byte) error {
+	conn, err := net.DialTimeout("tcp", address, printDialTimeout)
+	if err != nil {
+		return fmt.Errorf("falha ao ligar à impressora %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(printWriteTimeout)); err != nil {
+		return fmt.Errorf("falha ao definir prazo de escrita: %w", err)
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("falha ao enviar dados para a impressora %s: %w", address, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenPrinter abre um listener TCP local que faz de impressora e devolve, por canal,
+// o conteúdo recebido em cada ligação.
+func listenPrinter(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("falha ao abrir listener: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSendToPrinterDeliversPayload(t *testing.T) {
+	address, received := listenPrinter(t)
+	payload := []byte("^XA^FO50,50^BQN,2,6^FDQA,CG000123^FS^XZ")
+
+	if err := SendToPrinter(address, payload); err != nil {
+		t.Fatalf("SendToPrinter: %v", err)
+	}
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("recebido %q, esperado %q", data, payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a impressora não recebeu nada")
+	}
+}
+
+func TestSendToPrinterFailsWhenPrinterIsDown(t *testing.T) {
+	// Reserva uma porta e fecha-a, para que a ligação seja recusada
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("falha ao abrir listener: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if err := SendToPrinter(address, []byte("^XA^XZ")); err == nil {
+		t.Fatal("esperado erro com a impressora desligada")
+	}
+}
+
+func TestPrintBackoffDoubles(t *testing.T) {
+	expected := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second}
+	for i, want := range expected {
+		if got := printBackoff(i + 1); got != want {
+			t.Errorf("printBackoff(%d) = %s, esperado %s", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// backend/services/queueStateService.go
+package services
+
+import (
+	"database/sql"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// QueueState é a fotografia atual da fila: pacotes ativos e estatísticas por buffer.
+// Partilhado pelas mensagens do WebSocket, pelos snapshots de backlog e pelas métricas.
+type QueueState struct {
+	Packages       []models.Package
+	BacklogCount   int64                 // Contagem de itens (excluindo SAL)
+	BacklogValue   int64                 // Soma dos valores (P=250, M=80, G=10)
+	BufferCounts   map[string]int64      // Contagem por buffer
+	BufferValues   map[string]int64      // Soma de valores por buffer
+	BufferAvgTimes map[string]float64    // Tempo médio em segundos (só RTS e EHA)
+	BufferDwell    map[string]DwellStats // Percentis, máximo e contagem acima do SLA (só RTS e EHA)
+}
+
+// emptyQueueState devolve o estado com todos os buffers a zero.
+func emptyQueueState() QueueState {
+	return QueueState{
+		Packages:       []models.Package{},
+		BufferCounts:   map[string]int64{"RTS": 0, "EHA": 0, "SAL": 0},
+		BufferValues:   map[string]int64{"RTS": 0, "EHA": 0, "SAL": 0},
+		BufferAvgTimes: map[string]float64{"RTS": 0.0, "EHA": 0.0},
+		BufferDwell:    map[string]DwellStats{"RTS": {}, "EHA": {}},
+	}
+}
+
+// GetCurrentQueueState carrega todos os pacotes ativos e calcula as estatísticas por buffer.
+// Em caso de erro devolve também um estado vazio (todos os buffers a zero).
+func GetCurrentQueueState() (QueueState, error) {
+	return loadQueueState(true)
+}
+
+// GetQueueStats calcula apenas as estatísticas por buffer, lendo só as colunas necessárias.
+// State.Packages vem vazio. Usado nas mensagens "stats_changed" do WebSocket.
+func GetQueueStats() (QueueState, error) {
+	return loadQueueState(false)
+}
+
+func loadQueueState(withPackages bool) (QueueState, error) {
+	state := emptyQueueState()
+	bufferTotalSeconds := map[string]float64{"RTS": 0.0, "EHA": 0.0} // SAL não precisa
+	bufferSamples := map[string][]DwellSample{"RTS": {}, "EHA": {}}
+	now := GetBrasiliaTime()
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Busca todos os pacotes ativos
+		query := tx.Where("buffer <> ?", "PENDENTE").Order("entry_timestamp asc")
+		if !withPackages {
+			query = query.Select("tracking_id", "buffer", "profile_value", "entry_timestamp")
+		}
+		if err := query.Find(&state.Packages).Error; err != nil {
+			return err
+		}
+
+		for _, pkg := range state.Packages {
+			// Calcula tempo de permanência se o timestamp não for zero
+			var durationSeconds float64 = 0
+			if !pkg.EntryTimestamp.IsZero() {
+				durationSeconds = now.Sub(pkg.EntryTimestamp).Seconds()
+			}
+
+			// Conta e Soma para BACKLOG (Excluindo SAL)
+			if pkg.Buffer != "SAL" {
+				state.BacklogCount++
+				state.BacklogValue += int64(pkg.ProfileValue)
+			}
+
+			// Conta, Soma e Tempo Total por BUFFER
+			switch pkg.Buffer {
+			case "RTS", "EHA":
+				state.BufferCounts[pkg.Buffer]++
+				state.BufferValues[pkg.Buffer] += int64(pkg.ProfileValue)
+				bufferTotalSeconds[pkg.Buffer] += durationSeconds
+				bufferSamples[pkg.Buffer] = append(bufferSamples[pkg.Buffer], DwellSample{TrackingID: pkg.TrackingID, EntryTimestamp: pkg.EntryTimestamp})
+			case "SAL":
+				state.BufferCounts["SAL"]++
+				// BufferValues["SAL"] permanece 0 e o tempo não é calculado
+			}
+		}
+
+		// Calcula Tempo Médio
+		for _, buffer := range []string{"RTS", "EHA"} {
+			if state.BufferCounts[buffer] > 0 {
+				state.BufferAvgTimes[buffer] = bufferTotalSeconds[buffer] / float64(state.BufferCounts[buffer])
+			}
+			state.BufferDwell[buffer] = ComputeDwellStats(bufferSamples[buffer], now, DwellSLAThreshold(tx, buffer))
+		}
+
+		return nil
+	}, &sql.TxOptions{ReadOnly: true})
+
+	if err != nil {
+		return emptyQueueState(), err
+	}
+	if !withPackages {
+		state.Packages = []models.Package{}
+	}
+	return state, nil
+}
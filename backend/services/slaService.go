@@ -0,0 +1,281 @@
+// backend/services/slaService.go
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/events"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Níveis e estados dos alertas de SLA.
+const (
+	SLALevelWarning  = "AVISO"
+	SLALevelCritical = "CRITICO"
+
+	SLAStatusOpen         = "ABERTO"
+	SLAStatusAcknowledged = "RECONHECIDO"
+	SLAStatusResolved     = "RESOLVIDO"
+)
+
+// Eventos enviados aos clientes na mensagem "sla_alert".
+const (
+	SLAEventOpened       = "opened"
+	SLAEventEscalated    = "escalated"
+	SLAEventAcknowledged = "acknowledged"
+	SLAEventResolved     = "resolved"
+)
+
+// ErrAlertNotFound é devolvido quando o alerta não existe.
+var ErrAlertNotFound = errors.New("alerta não encontrado")
+
+// ErrAlertAlreadyResolved é devolvido ao tentar alterar um alerta já resolvido.
+var ErrAlertAlreadyResolved = errors.New("o alerta já foi resolvido")
+
+// SLAAlertChange é uma alteração de alerta a comunicar aos clientes.
+type SLAAlertChange struct {
+	Event string
+	Alert models.SLAAlert
+}
+
+// FindSLARule escolhe a regra aplicável a uma gaiola: primeiro a do buffer e perfil,
+// depois a regra geral do buffer (perfil vazio). Devolve nil se não houver nenhuma.
+func FindSLARule(rules []models.SLARule, buffer, profile string) *models.SLARule {
+	var general *models.SLARule
+	for i := range rules {
+		if rules[i].Buffer != buffer {
+			continue
+		}
+		if rules[i].Profile == profile {
+			return &rules[i]
+		}
+		if rules[i].Profile == "" {
+			general = &rules[i]
+		}
+	}
+	return general
+}
+
+// slaLevel devolve o nível atingido por uma gaiola com a permanência indicada ("" se nenhum).
+func slaLevel(rule *models.SLARule, dwell time.Duration) string {
+	switch {
+	case rule.CriticalMinutes > 0 && dwell >= time.Duration(rule.CriticalMinutes)*time.Minute:
+		return SLALevelCritical
+	case rule.WarningMinutes > 0 && dwell >= time.Duration(rule.WarningMinutes)*time.Minute:
+		return SLALevelWarning
+	}
+	return ""
+}
+
+// LoadActiveSLARules carrega as regras de SLA ativas.
+func LoadActiveSLARules(db *gorm.DB) ([]models.SLARule, error) {
+	var rules []models.SLARule
+	err := db.Where("active = ?", true).Find(&rules).Error
+	return rules, err
+}
+
+// EvaluateSLA compara a permanência de cada gaiola ativa com as regras de SLA:
+// abre alertas AVISO, escala-os para CRITICO e resolve automaticamente os alertas
+// das gaiolas que já saíram do buffer. Devolve as alterações a comunicar.
+func EvaluateSLA() ([]SLAAlertChange, error) {
+	var changes []SLAAlertChange
+	now := GetBrasiliaTime()
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		rules, err := LoadActiveSLARules(tx)
+		if err != nil {
+			return fmt.Errorf("erro ao buscar regras de SLA: %w", err)
+		}
+
+		var packages []models.Package
+		if len(rules) > 0 {
+			buffers := make([]string, 0, len(rules))
+			for _, rule := range rules {
+				buffers = append(buffers, rule.Buffer)
+			}
+			if err := tx.Where("buffer IN ?", buffers).Find(&packages).Error; err != nil {
+				return fmt.Errorf("erro ao buscar gaiolas ativas: %w", err)
+			}
+		}
+
+		// Além dos alertas abertos, os já resolvidos das gaiolas ainda no buffer evitam que
+		// um alerta fechado manualmente volte a ser aberto na avaliação seguinte.
+		var alerts []models.SLAAlert
+		query := tx.Where("status <> ?", SLAStatusResolved)
+		if len(packages) > 0 {
+			packageIDs := make([]uint, 0, len(packages))
+			for _, pkg := range packages {
+				packageIDs = append(packageIDs, pkg.ID)
+			}
+			query = query.Or("package_id IN ?", packageIDs)
+		}
+		if err := query.Find(&alerts).Error; err != nil {
+			return fmt.Errorf("erro ao buscar alertas: %w", err)
+		}
+
+		// Uma passagem de uma gaiola num buffer é identificada pelo pacote e pela hora de entrada.
+		type stayKey struct {
+			packageID uint
+			entry     int64
+		}
+		active := make(map[stayKey]models.Package, len(packages))
+		for _, pkg := range packages {
+			active[stayKey{pkg.ID, pkg.EntryTimestamp.Unix()}] = pkg
+		}
+
+		alerted := make(map[stayKey]bool, len(alerts))
+		for _, alert := range alerts {
+			key := stayKey{alert.PackageID, alert.EntryTimestamp.Unix()}
+			pkg, stillActive := active[key]
+			stillActive = stillActive && pkg.Buffer == alert.Buffer
+			if !stillActive && alert.Status == SLAStatusResolved {
+				continue // Alerta de uma passagem anterior
+			}
+			if !stillActive {
+				alert.Status = SLAStatusResolved
+				alert.ResolvedAt = &now
+				alert.ResolvedBy = SystemUser.Username
+				alert.Resolution = "A gaiola saiu do buffer"
+				if err := tx.Save(&alert).Error; err != nil {
+					return fmt.Errorf("falha ao resolver o alerta #%d: %w", alert.ID, err)
+				}
+				changes = append(changes, SLAAlertChange{Event: SLAEventResolved, Alert: alert})
+				continue
+			}
+			alerted[key] = true
+
+			rule := FindSLARule(rules, pkg.Buffer, pkg.Profile)
+			if rule == nil || alert.Level == SLALevelCritical {
+				continue
+			}
+			if slaLevel(rule, now.Sub(pkg.EntryTimestamp)) == SLALevelCritical {
+				// A escalada volta a abrir um alerta já reconhecido ou resolvido.
+				alert.Level = SLALevelCritical
+				alert.Status = SLAStatusOpen
+				alert.ResolvedAt = nil
+				alert.ResolvedBy = ""
+				alert.Resolution = ""
+				alert.Rua = pkg.Rua
+				alert.EscalatedAt = &now
+				if err := tx.Save(&alert).Error; err != nil {
+					return fmt.Errorf("falha ao escalar o alerta #%d: %w", alert.ID, err)
+				}
+				changes = append(changes, SLAAlertChange{Event: SLAEventEscalated, Alert: alert})
+			}
+		}
+
+		for key, pkg := range active {
+			if alerted[key] || pkg.EntryTimestamp.IsZero() {
+				continue
+			}
+			rule := FindSLARule(rules, pkg.Buffer, pkg.Profile)
+			if rule == nil {
+				continue
+			}
+			level := slaLevel(rule, now.Sub(pkg.EntryTimestamp))
+			if level == "" {
+				continue
+			}
+			alert := models.SLAAlert{
+				PackageID:      pkg.ID,
+				TrackingID:     pkg.TrackingID,
+				Buffer:         pkg.Buffer,
+				Rua:            pkg.Rua,
+				Profile:        pkg.Profile,
+				EntryTimestamp: pkg.EntryTimestamp,
+				Level:          level,
+				Status:         SLAStatusOpen,
+				TriggeredAt:    now,
+			}
+			if err := tx.Create(&alert).Error; err != nil {
+				return fmt.Errorf("falha ao abrir alerta para %s: %w", pkg.TrackingID, err)
+			}
+			changes = append(changes, SLAAlertChange{Event: SLAEventOpened, Alert: alert})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// PublishSLAAlertChanges publica as alterações no barramento de eventos, depois de gravadas.
+// changedBy é o utilizador que reconheceu ou resolveu o alerta (vazio na avaliação automática).
+func PublishSLAAlertChanges(changes []SLAAlertChange, changedBy models.User) {
+	for _, change := range changes {
+		events.B.Publish(events.SLAAlertChanged{Event: change.Event, Alert: change.Alert, ChangedBy: changedBy})
+	}
+}
+
+// SummarizeSLAChanges descreve as alterações para o resultado da tarefa agendada.
+func SummarizeSLAChanges(changes []SLAAlertChange) string {
+	counts := map[string]int{}
+	for _, change := range changes {
+		counts[change.Event]++
+	}
+	return fmt.Sprintf("%d alertas abertos, %d escalados, %d resolvidos",
+		counts[SLAEventOpened], counts[SLAEventEscalated], counts[SLAEventResolved])
+}
+
+// AcknowledgeSLAAlert marca um alerta aberto como reconhecido pelo utilizador.
+func AcknowledgeSLAAlert(id uint, user models.User) (models.SLAAlert, error) {
+	var alert models.SLAAlert
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&alert, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAlertNotFound
+			}
+			return err
+		}
+		if alert.Status == SLAStatusResolved {
+			return ErrAlertAlreadyResolved
+		}
+
+		now := GetBrasiliaTime()
+		alert.Status = SLAStatusAcknowledged
+		alert.AcknowledgedAt = &now
+		alert.AcknowledgedBy = user.Username
+		if err := tx.Save(&alert).Error; err != nil {
+			return err
+		}
+		logDetails := fmt.Sprintf("Alerta de SLA %s da gaiola %s no buffer %s reconhecido", alert.Level, alert.TrackingID, alert.Buffer)
+		return CreateAuditLog(tx, user, "ALERTA_RECONHECIDO", logDetails)
+	})
+	return alert, err
+}
+
+// ResolveSLAAlert fecha um alerta manualmente, com uma nota opcional.
+func ResolveSLAAlert(id uint, user models.User, resolution string) (models.SLAAlert, error) {
+	var alert models.SLAAlert
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&alert, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAlertNotFound
+			}
+			return err
+		}
+		if alert.Status == SLAStatusResolved {
+			return ErrAlertAlreadyResolved
+		}
+
+		now := GetBrasiliaTime()
+		alert.Status = SLAStatusResolved
+		alert.ResolvedAt = &now
+		alert.ResolvedBy = user.Username
+		alert.Resolution = resolution
+		if err := tx.Save(&alert).Error; err != nil {
+			return err
+		}
+		logDetails := fmt.Sprintf("Alerta de SLA %s da gaiola %s no buffer %s resolvido", alert.Level, alert.TrackingID, alert.Buffer)
+		if resolution != "" {
+			logDetails += fmt.Sprintf(" (%s)", resolution)
+		}
+		return CreateAuditLog(tx, user, "ALERTA_RESOLVIDO", logDetails)
+	})
+	return alert, err
+}
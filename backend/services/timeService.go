@@ -22,4 +22,15 @@ func init() {
 // Esta função é agora a fonte oficial de tempo para todas as operações do sistema.
 func GetBrasiliaTime() time.Time {
 	return time.Now().In(brasiliaLocation)
-}
\ No newline at end of file
+}
+
+// brasiliaBucketSQL devolve a expressão SQL que arredonda column ao início do seu intervalo de
+// tamanho interval, com os intervalos alinhados à hora de Brasília (ex: dias a começar à
+// meia-noite local), e os argumentos da expressão. Arredonda-se a hora local e converte-se o
+// início do intervalo de volta para o fuso.
+func brasiliaBucketSQL(column string, interval time.Duration) (string, []interface{}) {
+	seconds := int64(interval.Seconds())
+	zone := brasiliaLocation.String()
+	expr := "(to_timestamp(floor(extract(epoch from " + column + " AT TIME ZONE ?) / ?) * ?) AT TIME ZONE 'UTC') AT TIME ZONE ?"
+	return expr, []interface{}{zone, seconds, seconds, zone}
+}
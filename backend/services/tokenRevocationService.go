@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// As revogações são consultadas em cada pedido autenticado, por isso ficam em memória e são
+// relidas da base de dados a cada revocationRefresh. A instância que revoga atualiza a sua
+// cópia de imediato; as outras recebem o aviso pelo WebSocket (ver websocket.DisconnectUser)
+// ou, no pior caso, na leitura seguinte.
+const revocationRefresh = 15 * time.Second
+
+type revocationCache struct {
+	mu       sync.RWMutex
+	byUser   map[uint]time.Time
+	loadedAt time.Time
+}
+
+var revocations revocationCache
+
+// revocationLoads garante que, com a cópia desatualizada, os pedidos em simultâneo esperam
+// por uma única leitura da base de dados em vez de fazerem uma cada.
+var revocationLoads singleflight.Group
+
+// RevokeUserTokens invalida todos os tokens do utilizador emitidos até agora, e os tickets
+// do WebSocket ainda por usar. Os tokens emitidos depois (novo login) continuam válidos.
+func RevokeUserTokens(userID uint, revokedBy models.User, reason string) (time.Time, error) {
+	revocation := models.TokenRevocation{
+		UserID:    userID,
+		RevokedAt: GetBrasiliaTime(),
+		RevokedBy: revokedBy.Username,
+		Reason:    reason,
+	}
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"revoked_at", "revoked_by", "reason"}),
+		}).Create(&revocation).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.WebSocketTicket{}).Error
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	revocations.mu.Lock()
+	if revocations.byUser == nil {
+		revocations.byUser = make(map[uint]time.Time)
+	}
+	revocations.byUser[userID] = revocation.RevokedAt
+	revocations.mu.Unlock()
+	return revocation.RevokedAt, nil
+}
+
+// TokenRevoked indica se um token do utilizador emitido em issuedAt foi revogado, isto é,
+// emitido antes da revogação. O login que se segue à revogação, mesmo no mesmo segundo,
+// continua válido porque o "iat" tem milissegundos.
+func TokenRevoked(userID uint, issuedAt time.Time) bool {
+	revocations.mu.RLock()
+	stale := time.Since(revocations.loadedAt) > revocationRefresh
+	revocations.mu.RUnlock()
+	if stale {
+		revocationLoads.Do("revocations", func() (interface{}, error) {
+			RefreshTokenRevocations()
+			return nil, nil
+		})
+	}
+
+	revocations.mu.RLock()
+	defer revocations.mu.RUnlock()
+	revokedAt, ok := revocations.byUser[userID]
+	return ok && issuedAt.Before(revokedAt)
+}
+
+// RefreshTokenRevocations relê as revogações ainda relevantes: as anteriores à validade
+// de um token já não afetam nenhum token por expirar.
+func RefreshTokenRevocations() {
+	var rows []models.TokenRevocation
+	err := initializers.DB.Where("revoked_at > ?", GetBrasiliaTime().Add(-config.AppConfig.JWTExpirationTime)).Find(&rows).Error
+
+	revocations.mu.Lock()
+	defer revocations.mu.Unlock()
+	// Em caso de erro mantém a cópia anterior e só volta a tentar no intervalo seguinte
+	revocations.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("Erro ao carregar revogações de tokens: %v", err)
+		return
+	}
+	revocations.byUser = make(map[uint]time.Time, len(rows))
+	for _, row := range rows {
+		revocations.byUser[row.UserID] = row.RevokedAt
+	}
+}
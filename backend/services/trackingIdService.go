@@ -0,0 +1,163 @@
+// backend/services/trackingIdService.go
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/config"
+	"fifo-system/backend/models"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTrackingScheme é o esquema das gaiolas (CG000123), usado quando nenhum é indicado.
+const DefaultTrackingScheme = "GAIOLA"
+
+const checkDigitAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// ErrInvalidCheckDigit é devolvido quando o TrackingID lido ou digitado não passa na verificação.
+var ErrInvalidCheckDigit = errors.New("código inválido: dígito verificador não confere (verifique se foi digitado corretamente)")
+
+// ErrUnknownScheme é devolvido quando o ID não corresponde a nenhum esquema ativo.
+var ErrUnknownScheme = errors.New("código inválido: não corresponde a nenhum formato de etiqueta ativo")
+
+// ComputeCheckDigit calcula o dígito verificador ISO 7064 MOD 37,36 de um ID alfanumérico.
+// Deteta todos os erros de um só carácter e quase todas as trocas de caracteres adjacentes
+// (ex: CG000132 em vez de CG000123).
+func ComputeCheckDigit(id string) (byte, error) {
+	const m = 36
+	p := m
+	for _, r := range strings.ToUpper(id) {
+		value := strings.IndexRune(checkDigitAlphabet, r)
+		if value < 0 {
+			return 0, errors.New("o ID contém caracteres não alfanuméricos")
+		}
+		s := (p + value) % m
+		if s == 0 {
+			s = m
+		}
+		p = (2 * s) % (m + 1)
+	}
+	return checkDigitAlphabet[(m+1-p)%m], nil
+}
+
+// AppendCheckDigit devolve o ID com o dígito verificador no final.
+func AppendCheckDigit(id string) (string, error) {
+	digit, err := ComputeCheckDigit(id)
+	if err != nil {
+		return "", err
+	}
+	return id + string(digit), nil
+}
+
+// HasValidCheckDigit indica se o último carácter do ID é o dígito verificador correto.
+func HasValidCheckDigit(id string) bool {
+	if len(id) < 2 {
+		return false
+	}
+	digit, err := ComputeCheckDigit(id[:len(id)-1])
+	return err == nil && strings.ToUpper(id[len(id)-1:]) == string(digit)
+}
+
+// FormatTrackingID monta o ID de número n no formato do esquema (prefixo, largura e dígito).
+func FormatTrackingID(scheme models.TrackingIDScheme, n int64) (string, error) {
+	id := fmt.Sprintf("%s%0*d", scheme.Prefix, scheme.Width, n)
+	if len(id) != len(scheme.Prefix)+scheme.Width {
+		return "", fmt.Errorf("o esquema %s esgotou os números disponíveis", scheme.Name)
+	}
+	if scheme.CheckDigit {
+		return AppendCheckDigit(id)
+	}
+	return id, nil
+}
+
+// ParseTrackingID verifica se o ID segue o formato do esquema e devolve o seu número sequencial.
+// Devolve ErrInvalidCheckDigit se o formato coincidir mas o dígito verificador estiver errado.
+func ParseTrackingID(scheme models.TrackingIDScheme, id string) (int64, error) {
+	expectedLen := len(scheme.Prefix) + scheme.Width
+	if scheme.CheckDigit {
+		expectedLen++
+	}
+	if len(id) != expectedLen || !strings.HasPrefix(id, scheme.Prefix) {
+		return 0, ErrUnknownScheme
+	}
+	digits := id[len(scheme.Prefix) : len(scheme.Prefix)+scheme.Width]
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, ErrUnknownScheme
+	}
+	if scheme.CheckDigit && !HasValidCheckDigit(id) {
+		return 0, ErrInvalidCheckDigit
+	}
+	return n, nil
+}
+
+// FindActiveScheme carrega um esquema ativo pelo nome (ou o esquema padrão se vazio).
+func FindActiveScheme(db *gorm.DB, name string) (models.TrackingIDScheme, error) {
+	if name == "" {
+		name = DefaultTrackingScheme
+	}
+	var scheme models.TrackingIDScheme
+	err := db.Where("name = ? AND active = ?", strings.ToUpper(name), true).First(&scheme).Error
+	return scheme, err
+}
+
+// ResolveTrackingID identifica o esquema ativo a que um ID lido ou digitado pertence.
+// Para permitir a migração, IDs antigos fora de qualquer esquema (ou sem dígito verificador)
+// são aceites se já existirem na base de dados, sem esquema ou num esquema ainda ativo, e
+// TRACKING_ID_ACCEPT_LEGACY estiver ativo; nesse caso é devolvido o esquema já gravado no pacote.
+func ResolveTrackingID(db *gorm.DB, id string) (string, error) {
+	var schemes []models.TrackingIDScheme
+	if err := db.Where("active = ?", true).Find(&schemes).Error; err != nil {
+		return "", err
+	}
+	return resolveTrackingID(schemes, id, func() ([]models.Package, error) {
+		var legacy []models.Package
+		err := db.Unscoped().Where("tracking_id = ?", id).Limit(1).Find(&legacy).Error
+		return legacy, err
+	})
+}
+
+// resolveTrackingID é ResolveTrackingID sem acesso à base de dados: recebe os esquemas ativos
+// e a função que procura o pacote já gravado com o ID, chamada só se o ID for de formato antigo.
+func resolveTrackingID(schemes []models.TrackingIDScheme, id string, findLegacy func() ([]models.Package, error)) (string, error) {
+	resolveErr := ErrUnknownScheme
+	for _, scheme := range schemes {
+		_, err := ParseTrackingID(scheme, id)
+		if err == nil {
+			return scheme.Name, nil
+		}
+		if errors.Is(err, ErrInvalidCheckDigit) {
+			resolveErr = err
+		}
+	}
+
+	if config.AppConfig.TrackingAcceptLegacy {
+		legacy, err := findLegacy()
+		if err != nil {
+			return "", err
+		}
+		// Etiquetas de esquemas desativados continuam recusadas, mesmo que já existam.
+		if len(legacy) > 0 && (legacy[0].Scheme == "" || isActiveScheme(schemes, legacy[0].Scheme)) {
+			return legacy[0].Scheme, nil
+		}
+	}
+	return "", resolveErr
+}
+
+func isActiveScheme(schemes []models.TrackingIDScheme, name string) bool {
+	for _, scheme := range schemes {
+		if scheme.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTrackingID verifica se o ID pertence a um esquema ativo, incluindo o dígito verificador.
+func ValidateTrackingID(db *gorm.DB, id string) error {
+	_, err := ResolveTrackingID(db, id)
+	return err
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fifo-system/backend/config"
+	"fifo-system/backend/models"
+	"testing"
+)
+
+var (
+	gaiolaScheme = models.TrackingIDScheme{Name: "GAIOLA", Prefix: "CG", Width: 6, CheckDigit: true}
+	paleteScheme = models.TrackingIDScheme{Name: "PALETE", Prefix: "PL", Width: 4}
+)
+
+func TestComputeCheckDigit(t *testing.T) {
+	tests := []struct {
+		id   string
+		want byte
+	}{
+		{"A12425GABC1234002", 'M'}, // Exemplo da ISO 7064 MOD 37,36
+		{"CG000123", 'L'},
+		{"CG000132", 'J'}, // Troca de algarismos adjacentes: dígito diferente
+		{"PL0001", 'K'},
+		{"cg000123", 'L'}, // Minúsculas contam como maiúsculas
+	}
+	for _, tt := range tests {
+		got, err := ComputeCheckDigit(tt.id)
+		if err != nil {
+			t.Errorf("ComputeCheckDigit(%q): %v", tt.id, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ComputeCheckDigit(%q) = %c, esperado %c", tt.id, got, tt.want)
+		}
+	}
+
+	if _, err := ComputeCheckDigit("CG-000123"); err == nil {
+		t.Error("esperado erro com caracteres não alfanuméricos")
+	}
+}
+
+func TestHasValidCheckDigit(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"A12425GABC1234002M", true},
+		{"CG000123L", true},
+		{"CG000132J", true},
+		{"cg000123l", true},  // Leitura em minúsculas
+		{"CG000132L", false}, // Algarismos trocados
+		{"CG000124L", false}, // Um algarismo errado
+		{"CG000123M", false}, // Dígito verificador errado
+		{"DG000123L", false}, // Prefixo errado
+		{"L", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := HasValidCheckDigit(tt.id); got != tt.want {
+			t.Errorf("HasValidCheckDigit(%q) = %v, esperado %v", tt.id, got, tt.want)
+		}
+	}
+
+	// Qualquer alteração de um só carácter é detetada
+	const valid = "CG000123L"
+	for i := 0; i < len(valid); i++ {
+		for _, r := range checkDigitAlphabet {
+			if byte(r) == valid[i] {
+				continue
+			}
+			changed := valid[:i] + string(r) + valid[i+1:]
+			if HasValidCheckDigit(changed) {
+				t.Errorf("HasValidCheckDigit(%q) = true, esperado false", changed)
+			}
+		}
+	}
+}
+
+func TestFormatTrackingID(t *testing.T) {
+	tests := []struct {
+		scheme models.TrackingIDScheme
+		n      int64
+		want   string
+	}{
+		{gaiolaScheme, 123, "CG000123L"},
+		{gaiolaScheme, 132, "CG000132J"},
+		{paleteScheme, 1, "PL0001"},
+		{paleteScheme, 9999, "PL9999"},
+	}
+	for _, tt := range tests {
+		got, err := FormatTrackingID(tt.scheme, tt.n)
+		if err != nil {
+			t.Errorf("FormatTrackingID(%s, %d): %v", tt.scheme.Name, tt.n, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FormatTrackingID(%s, %d) = %q, esperado %q", tt.scheme.Name, tt.n, got, tt.want)
+		}
+	}
+
+	if _, err := FormatTrackingID(paleteScheme, 10000); err == nil {
+		t.Error("esperado erro quando o número não cabe na largura do esquema")
+	}
+}
+
+func TestParseTrackingID(t *testing.T) {
+	tests := []struct {
+		scheme  models.TrackingIDScheme
+		id      string
+		want    int64
+		wantErr error
+	}{
+		{gaiolaScheme, "CG000123L", 123, nil},
+		{gaiolaScheme, "CG000132J", 132, nil},
+		{gaiolaScheme, "CG000132L", 0, ErrInvalidCheckDigit},
+		{gaiolaScheme, "CG000124L", 0, ErrInvalidCheckDigit},
+		{gaiolaScheme, "CG000123", 0, ErrUnknownScheme}, // Sem dígito verificador
+		{gaiolaScheme, "CG00A123L", 0, ErrUnknownScheme},
+		{gaiolaScheme, "PL000123L", 0, ErrUnknownScheme},
+		{gaiolaScheme, "cg000123l", 0, ErrUnknownScheme}, // Os IDs gravados são sempre em maiúsculas
+		{paleteScheme, "PL0042", 42, nil},
+		{paleteScheme, "PL00042", 0, ErrUnknownScheme},
+	}
+	for _, tt := range tests {
+		got, err := ParseTrackingID(tt.scheme, tt.id)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ParseTrackingID(%s, %q): erro %v, esperado %v", tt.scheme.Name, tt.id, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTrackingID(%s, %q) = %d, esperado %d", tt.scheme.Name, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestResolveTrackingIDLegacy(t *testing.T) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+
+	schemes := []models.TrackingIDScheme{gaiolaScheme, paleteScheme}
+	stored := map[string]models.Package{
+		"CG123":     {TrackingID: "CG123"},                      // Anterior aos esquemas
+		"CG000777":  {TrackingID: "CG000777", Scheme: "GAIOLA"}, // Gravado antes do dígito verificador
+		"TT000001X": {TrackingID: "TT000001X", Scheme: "TOTE"},  // Esquema desativado
+	}
+
+	tests := []struct {
+		id         string
+		acceptOld  bool
+		wantScheme string
+		wantErr    error
+	}{
+		{"CG000123L", false, "GAIOLA", nil},
+		{"PL0042", false, "PALETE", nil},
+		{"CG000132L", false, "", ErrInvalidCheckDigit},
+		{"CG000132L", true, "", ErrInvalidCheckDigit}, // Não existe na base de dados
+		{"CG123", false, "", ErrUnknownScheme},
+		{"CG123", true, "", nil},
+		{"CG000777", false, "", ErrUnknownScheme},
+		{"CG000777", true, "GAIOLA", nil},
+		{"TT000001X", true, "", ErrUnknownScheme},
+		{"XX999", true, "", ErrUnknownScheme},
+	}
+	for _, tt := range tests {
+		config.AppConfig = &config.Config{TrackingAcceptLegacy: tt.acceptOld}
+		lookups := 0
+		findLegacy := func() ([]models.Package, error) {
+			lookups++
+			if pkg, ok := stored[tt.id]; ok {
+				return []models.Package{pkg}, nil
+			}
+			return nil, nil
+		}
+
+		scheme, err := resolveTrackingID(schemes, tt.id, findLegacy)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("resolveTrackingID(%q, legado=%v): erro %v, esperado %v", tt.id, tt.acceptOld, err, tt.wantErr)
+			continue
+		}
+		if scheme != tt.wantScheme {
+			t.Errorf("resolveTrackingID(%q, legado=%v) = %q, esperado %q", tt.id, tt.acceptOld, scheme, tt.wantScheme)
+		}
+		if !tt.acceptOld && lookups > 0 {
+			t.Errorf("resolveTrackingID(%q) procurou o ID antigo com TRACKING_ID_ACCEPT_LEGACY desativado", tt.id)
+		}
+	}
+}
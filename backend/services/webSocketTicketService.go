@@ -0,0 +1,93 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WebSocketTicketTTL é a validade de um ticket do WebSocket: só precisa de durar
+// o tempo entre o pedido do ticket e a abertura da ligação.
+const WebSocketTicketTTL = 30 * time.Second
+
+// ErrInvalidWebSocketTicket é devolvido para tickets inexistentes, já usados ou expirados.
+var ErrInvalidWebSocketTicket = errors.New("ticket inválido ou expirado")
+
+func hashWebSocketTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueWebSocketTicket cria um ticket de uso único para o utilizador do token.
+// Aproveita para apagar os tickets expirados que nunca foram usados.
+func IssueWebSocketTicket(user models.User) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := hex.EncodeToString(buf)
+
+	permissions := make([]string, 0, len(user.Role.Permissions))
+	for _, p := range user.Role.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+	now := GetBrasiliaTime()
+	record := models.WebSocketTicket{
+		TicketHash:  hashWebSocketTicket(ticket),
+		UserID:      user.ID,
+		Username:    user.Username,
+		FullName:    user.FullName,
+		Role:        user.Role.Name,
+		Permissions: strings.Join(permissions, ","),
+		ExpiresAt:   now.Add(WebSocketTicketTTL),
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&models.WebSocketTicket{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return ticket, record.ExpiresAt, nil
+}
+
+// RedeemWebSocketTicket consome um ticket e devolve o utilizador a que pertence.
+// O ticket é apagado na mesma instrução em que é lido, por isso só pode ser usado uma vez,
+// mesmo com pedidos simultâneos em instâncias diferentes.
+func RedeemWebSocketTicket(ticket string) (models.User, error) {
+	if ticket == "" {
+		return models.User{}, ErrInvalidWebSocketTicket
+	}
+	var record models.WebSocketTicket
+	result := initializers.DB.Clauses(clause.Returning{}).Where("ticket_hash = ?", hashWebSocketTicket(ticket)).Delete(&record)
+	if result.Error != nil {
+		return models.User{}, result.Error
+	}
+	if result.RowsAffected == 0 || GetBrasiliaTime().After(record.ExpiresAt) {
+		return models.User{}, ErrInvalidWebSocketTicket
+	}
+
+	var permissions []models.Permission
+	for _, name := range strings.Split(record.Permissions, ",") {
+		if name != "" {
+			permissions = append(permissions, models.Permission{Name: name})
+		}
+	}
+	return models.User{
+		Model:    gorm.Model{ID: record.UserID},
+		Username: record.Username,
+		FullName: record.FullName,
+		Role:     models.Role{Name: record.Role, Permissions: permissions},
+	}, nil
+}
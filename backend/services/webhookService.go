@@ -0,0 +1,342 @@
+// backend/services/webhookService.go
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fifo-system/backend/events"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Eventos que podem ser subscritos por um webhook.
+const (
+	WebhookEventEntry = "entry"
+	WebhookEventExit  = "exit"
+	WebhookEventMove  = "move"
+	WebhookEventAlert = "alert"
+	// WebhookEventPing é enviado apenas pelo botão de teste, a todas as subscrições.
+	WebhookEventPing = "ping"
+)
+
+// WebhookEvents são os eventos aceites em WebhookSubscription.Events.
+var WebhookEvents = []string{WebhookEventEntry, WebhookEventExit, WebhookEventMove, WebhookEventAlert}
+
+const (
+	webhookWorkers       = 4
+	webhookMaxAttempts   = 8
+	webhookBaseBackoff   = 10 * time.Second // Duplica a cada tentativa: 10s, 20s, 40s... até 1h
+	webhookMaxBackoff    = time.Hour
+	webhookTimeout       = 10 * time.Second
+	webhookQueueCapacity = 1024
+	webhookMaxErrorBody  = 512
+
+	// webhookLease é o tempo durante o qual uma entrega ENVIANDO pertence a quem a reclamou.
+	// É bem maior do que o webhookTimeout de um envio; passado este tempo a instância que a
+	// reclamou terminou a meio e a entrega volta a PENDENTE.
+	webhookLease = 2 * time.Minute
+)
+
+// WebhookPayload é o corpo JSON enviado para os webhooks.
+type WebhookPayload struct {
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurredAt"`
+	Data       interface{} `json:"data"`
+}
+
+// webhookDispatcher entrega os WebhookDelivery em segundo plano,
+// com novas tentativas e backoff exponencial em caso de falha.
+type webhookDispatcher struct {
+	deliveries chan uint
+	client     *http.Client
+}
+
+// Webhooks é o despachante global, iniciado em main com go services.Webhooks.Run().
+var Webhooks = &webhookDispatcher{
+	deliveries: make(chan uint, webhookQueueCapacity),
+	client:     &http.Client{Timeout: webhookTimeout},
+}
+
+// GenerateWebhookSecret gera uma chave aleatória para assinar os envios.
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload calcula a assinatura enviada em X-FIFO-Signature:
+// "sha256=" + HMAC-SHA256(secret, timestamp + "." + corpo), em hexadecimal.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribesTo indica se a subscrição inclui o evento.
+func subscribesTo(sub models.WebhookSubscription, event string) bool {
+	if event == WebhookEventPing {
+		return true
+	}
+	for _, e := range strings.Split(sub.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Run inicia os workers e, a cada webhookLease, retoma as entregas abandonadas: as ENVIANDO
+// cujo envio expirou (instância terminada a meio) e as PENDENTE que nenhuma instância tem
+// agendadas. Com várias instâncias a correr, a reclamação atómica em process garante que
+// cada entrega só é enviada uma vez.
+func (d *webhookDispatcher) Run() {
+	for i := 0; i < webhookWorkers; i++ {
+		go d.worker()
+	}
+
+	d.recover()
+	ticker := time.NewTicker(webhookLease)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.recover()
+	}
+}
+
+// recover devolve a PENDENTE as entregas com o envio expirado e coloca na fila as pendentes
+// cuja próxima tentativa já chegou.
+func (d *webhookDispatcher) recover() {
+	expired := initializers.DB.Model(&models.WebhookDelivery{}).
+		Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", "ENVIANDO", GetBrasiliaTime().Add(-webhookLease)).
+		Updates(map[string]interface{}{"status": "PENDENTE", "claimed_at": nil})
+	if expired.Error != nil {
+		log.Printf("Erro ao retomar entregas de webhook interrompidas: %v", expired.Error)
+	} else if expired.RowsAffected > 0 {
+		log.Printf("%d entregas de webhook interrompidas voltaram a PENDENTE.", expired.RowsAffected)
+	}
+
+	// Só as que já estão para enviar: as de nova tentativa futura já têm temporizador na instância
+	// que as agendou, e se essa instância terminar um dos ticks seguintes apanha-as
+	var pending []models.WebhookDelivery
+	if err := initializers.DB.Where("status = ? AND (next_attempt IS NULL OR next_attempt <= ?)", "PENDENTE", GetBrasiliaTime()).
+		Find(&pending).Error; err != nil {
+		log.Printf("Erro ao retomar entregas de webhook pendentes: %v", err)
+		return
+	}
+	for _, delivery := range pending {
+		d.Enqueue(delivery.ID)
+	}
+}
+
+// Dispatch cria uma entrega por cada subscrição ativa interessada no evento e coloca-as na fila.
+// Deve ser chamado depois de a transação que originou o evento ter sido confirmada
+// (as operações da fila chegam aqui pelo barramento de eventos, em HandleEvent).
+func (d *webhookDispatcher) Dispatch(event string, data interface{}) {
+	if _, err := d.Deliver(event, data, 0); err != nil {
+		log.Printf("Erro ao criar entregas de webhook para o evento %s: %v", event, err)
+	}
+}
+
+// HandleEvent é o subscritor "webhooks" do barramento de eventos: envia as entradas,
+// saídas e movimentações de gaiolas (o PackageEvent gravado) e as alterações dos alertas
+// às subscrições interessadas.
+func (d *webhookDispatcher) HandleEvent(e events.Event) {
+	switch e := e.(type) {
+	case events.PackageEntered:
+		d.Dispatch(WebhookEventEntry, e.Record)
+	case events.PackageExited:
+		d.Dispatch(WebhookEventExit, e.Record)
+	case events.PackageMoved:
+		d.Dispatch(WebhookEventMove, e.Record)
+	case events.SLAAlertChanged:
+		d.Dispatch(WebhookEventAlert, alertWebhookData{Source: "sla", Event: e.Event, Alert: e.Alert})
+	case events.AlertRuleChanged:
+		state := "fired"
+		if e.Record.State == AlertRuleStateResolved {
+			state = "resolved"
+		}
+		d.Dispatch(WebhookEventAlert, alertWebhookData{Source: "rule", Event: state, Alert: e.Record})
+	}
+}
+
+// alertWebhookData é o "data" dos eventos "alert": Source indica se veio de um alerta
+// de SLA ("sla") ou de uma regra de alerta ("rule").
+type alertWebhookData struct {
+	Source string      `json:"source"`
+	Event  string      `json:"event"`
+	Alert  interface{} `json:"alert"`
+}
+
+// Deliver cria as entregas do evento (apenas para a subscrição indicada, se subscriptionID != 0)
+// e devolve quantas foram criadas.
+func (d *webhookDispatcher) Deliver(event string, data interface{}, subscriptionID uint) (int, error) {
+	query := initializers.DB.Where("active = ?", true)
+	if subscriptionID != 0 {
+		query = query.Where("id = ?", subscriptionID)
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := query.Find(&subscriptions).Error; err != nil {
+		return 0, err
+	}
+
+	var body []byte
+	var deliveries []models.WebhookDelivery
+	for _, sub := range subscriptions {
+		if !subscribesTo(sub, event) {
+			continue
+		}
+		if body == nil {
+			var err error
+			body, err = json.Marshal(WebhookPayload{Event: event, OccurredAt: GetBrasiliaTime(), Data: data})
+			if err != nil {
+				return 0, fmt.Errorf("falha ao serializar o evento: %w", err)
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Payload:        string(body),
+			Status:         "PENDENTE",
+		})
+	}
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+
+	if err := initializers.DB.Create(&deliveries).Error; err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		d.Enqueue(delivery.ID)
+	}
+	return len(deliveries), nil
+}
+
+// Enqueue coloca uma entrega na fila sem bloquear o pedido HTTP que a criou.
+func (d *webhookDispatcher) Enqueue(deliveryID uint) {
+	select {
+	case d.deliveries <- deliveryID:
+	default:
+		go func() { d.deliveries <- deliveryID }()
+	}
+}
+
+func (d *webhookDispatcher) enqueueAfter(deliveryID uint, delay time.Duration) {
+	if delay <= 0 {
+		d.Enqueue(deliveryID)
+		return
+	}
+	time.AfterFunc(delay, func() { d.Enqueue(deliveryID) })
+}
+
+func (d *webhookDispatcher) worker() {
+	for deliveryID := range d.deliveries {
+		d.process(deliveryID)
+	}
+}
+
+func (d *webhookDispatcher) process(deliveryID uint) {
+	// Reclama a entrega de forma atómica, para que nunca seja enviada duas vezes em paralelo.
+	claim := initializers.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ?", deliveryID, "PENDENTE").
+		Updates(map[string]interface{}{"status": "ENVIANDO", "attempts": gorm.Expr("attempts + 1"), "claimed_at": GetBrasiliaTime()})
+	if claim.Error != nil {
+		log.Printf("Erro ao reclamar entrega de webhook #%d: %v", deliveryID, claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return // Já entregue, falhada ou a ser enviada por outro worker
+	}
+
+	var delivery models.WebhookDelivery
+	if err := initializers.DB.Unscoped().Preload("Subscription", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).First(&delivery, deliveryID).Error; err != nil {
+		log.Printf("Erro ao carregar entrega de webhook #%d: %v", deliveryID, err)
+		return
+	}
+
+	statusCode, sendErr := d.send(delivery)
+
+	var retryIn time.Duration
+	updates := map[string]interface{}{"last_status_code": statusCode, "claimed_at": nil}
+	switch {
+	case sendErr == nil:
+		updates["status"] = "ENTREGUE"
+		updates["delivered_at"] = GetBrasiliaTime()
+		updates["last_error"] = ""
+		updates["next_attempt"] = nil
+	case delivery.Attempts >= webhookMaxAttempts || !delivery.Subscription.Active || delivery.Subscription.DeletedAt.Valid:
+		updates["status"] = "FALHOU"
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt"] = nil
+		log.Printf("Entrega de webhook #%d para %s falhou definitivamente após %d tentativas: %v", delivery.ID, delivery.Subscription.Name, delivery.Attempts, sendErr)
+	default:
+		retryIn = webhookBackoff(delivery.Attempts)
+		updates["status"] = "PENDENTE"
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt"] = GetBrasiliaTime().Add(retryIn)
+		log.Printf("Falha na entrega de webhook #%d para %s (tentativa %d), nova tentativa em %s: %v", delivery.ID, delivery.Subscription.Name, delivery.Attempts, retryIn, sendErr)
+	}
+
+	if err := initializers.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Erro ao atualizar estado da entrega de webhook #%d: %v", delivery.ID, err)
+		return
+	}
+	if retryIn > 0 {
+		d.enqueueAfter(delivery.ID, retryIn)
+	}
+}
+
+// webhookBackoff é a espera antes da tentativa seguinte à tentativa attempt (a primeira é 1).
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff * time.Duration(1<<(attempt-1))
+	if backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// send faz o POST assinado. Apenas respostas 2xx contam como entregues.
+func (d *webhookDispatcher) send(delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("URL inválida: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fifo-system-webhooks/1.0")
+	req.Header.Set("X-FIFO-Event", delivery.Event)
+	req.Header.Set("X-FIFO-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-FIFO-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-FIFO-Signature", SignWebhookPayload(delivery.Subscription.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("falha ao contactar %s: %w", delivery.Subscription.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorBody))
+		return resp.StatusCode, fmt.Errorf("resposta HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
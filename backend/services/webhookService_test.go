@@ -0,0 +1,151 @@
+package services
+
+import (
+	"crypto/hmac"
+	"fifo-system/backend/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// webhookRequest é o que o servidor de teste recebeu num envio.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// serveWebhook abre um servidor httptest que responde com os códigos indicados, um por pedido
+// (o último repete-se), e devolve, por canal, cada pedido recebido.
+func serveWebhook(t *testing.T, statusCodes ...int) (string, <-chan webhookRequest) {
+	t.Helper()
+	received := make(chan webhookRequest, 16)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{header: r.Header.Clone(), body: body}
+		status := statusCodes[min(calls, len(statusCodes)-1)]
+		calls++
+		w.WriteHeader(status)
+		io.WriteString(w, http.StatusText(status))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func testDelivery(url string) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{
+		Event:   WebhookEventEntry,
+		Payload: `{"event":"entry","data":{"TrackingID":"CG000123"}}`,
+		Subscription: models.WebhookSubscription{
+			Name:   "TMS",
+			URL:    url,
+			Secret: "segredo-de-teste",
+			Active: true,
+		},
+	}
+	delivery.ID = 42
+	return delivery
+}
+
+func TestWebhookSendSignsPayload(t *testing.T) {
+	url, received := serveWebhook(t, http.StatusOK)
+	delivery := testDelivery(url)
+
+	statusCode, err := Webhooks.send(delivery)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("código %d, esperado 200", statusCode)
+	}
+
+	request := <-received
+	if string(request.body) != delivery.Payload {
+		t.Fatalf("corpo %q, esperado %q", request.body, delivery.Payload)
+	}
+	if got := request.header.Get("X-FIFO-Event"); got != WebhookEventEntry {
+		t.Errorf("X-FIFO-Event = %q, esperado %q", got, WebhookEventEntry)
+	}
+	if got := request.header.Get("X-FIFO-Delivery"); got != "42" {
+		t.Errorf("X-FIFO-Delivery = %q, esperado \"42\"", got)
+	}
+
+	// O recetor valida a assinatura com a chave partilhada e o timestamp recebido
+	timestamp, err := strconv.ParseInt(request.header.Get("X-FIFO-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-FIFO-Timestamp inválido: %v", err)
+	}
+	expected := SignWebhookPayload(delivery.Subscription.Secret, timestamp, request.body)
+	if !hmac.Equal([]byte(request.header.Get("X-FIFO-Signature")), []byte(expected)) {
+		t.Fatalf("X-FIFO-Signature = %q, esperado %q", request.header.Get("X-FIFO-Signature"), expected)
+	}
+	if SignWebhookPayload("outra-chave", timestamp, request.body) == expected {
+		t.Fatal("a assinatura não depende da chave")
+	}
+}
+
+func TestWebhookSendRetriesUntilDelivered(t *testing.T) {
+	url, received := serveWebhook(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent)
+	delivery := testDelivery(url)
+
+	// Repete os envios como process: cada falha agenda nova tentativa com o backoff seguinte
+	var waits []time.Duration
+	for attempt := 1; ; attempt++ {
+		if attempt > webhookMaxAttempts {
+			t.Fatal("a entrega não foi concluída")
+		}
+		statusCode, err := Webhooks.send(delivery)
+		if err == nil {
+			if statusCode != http.StatusNoContent {
+				t.Fatalf("código %d, esperado 204", statusCode)
+			}
+			break
+		}
+		if statusCode < 500 {
+			t.Fatalf("tentativa %d: código %d, esperado 5xx: %v", attempt, statusCode, err)
+		}
+		waits = append(waits, webhookBackoff(attempt))
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("%d pedidos recebidos, esperados 3", len(received))
+	}
+	if len(waits) != 2 || waits[0] != 10*time.Second || waits[1] != 20*time.Second {
+		t.Fatalf("esperas %v, esperadas [10s 20s]", waits)
+	}
+	// O corpo reenviado é sempre o mesmo
+	for i := 0; i < 3; i++ {
+		if request := <-received; string(request.body) != delivery.Payload {
+			t.Fatalf("pedido %d com corpo %q", i+1, request.body)
+		}
+	}
+}
+
+func TestWebhookSendFailsWhenReceiverIsDown(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	statusCode, err := Webhooks.send(testDelivery(url))
+	if err == nil {
+		t.Fatal("esperado erro com o recetor desligado")
+	}
+	if statusCode != 0 {
+		t.Fatalf("código %d, esperado 0", statusCode)
+	}
+}
+
+func TestWebhookBackoffDoublesUpToMax(t *testing.T) {
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}
+	for i, want := range expected {
+		if got := webhookBackoff(i + 1); got != want {
+			t.Errorf("webhookBackoff(%d) = %s, esperado %s", i+1, got, want)
+		}
+	}
+	if got := webhookBackoff(webhookMaxAttempts + 4); got != webhookMaxBackoff {
+		t.Errorf("webhookBackoff(%d) = %s, esperado %s", webhookMaxAttempts+4, got, webhookMaxBackoff)
+	}
+}
@@ -0,0 +1,32 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// AnnouncementMessage é a mensagem "announcement", um aviso enviado por um líder
+// aos clientes subscritos ao tópico "announcements".
+type AnnouncementMessage struct {
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	From    string    `json:"from"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+// Announce envia um aviso a todos os clientes subscritos, em todas as instâncias.
+func (h *Hub) Announce(announcement AnnouncementMessage) {
+	announcement.Type = "announcement"
+	h.broadcastAnnouncement(announcement)
+	h.publish(clusterAnnouncement, announcement)
+}
+
+func (h *Hub) broadcastAnnouncement(announcement AnnouncementMessage) {
+	message, err := json.Marshal(announcement)
+	if err != nil {
+		log.Printf("Erro ao serializar aviso: %v", err)
+		return
+	}
+	h.broadcast(TopicAnnouncements, message)
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"fifo-system/backend/models"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 512  // Limite dos tipos sem entrada em inboundSizeLimits
+	maxInboundSize = 2048 // Maior limite de inboundSizeLimits: limite de leitura da ligação
+
+	// sendBufferSize é o número de mensagens que podem ficar à espera de envio para um
+	// cliente. Um cliente que enche a fila não está a acompanhar e é desligado.
+	sendBufferSize = 256
+)
+
+// Client representa um utilizador conectado via WebSocket.
+// Todas as escritas na ligação passam pelo canal send e são feitas apenas por writePump;
+// o hub nunca escreve diretamente em Conn.
+type Client struct {
+	Conn        *websocket.Conn
+	UserID      uint
+	FullName    string
+	Username    string
+	Role        string
+	Sector      string
+	UserAgent   string
+	IP          string
+	ConnectedAt time.Time
+
+	user          models.User // Utilizador do token, com as permissões usadas nos comandos
+	send          chan []byte
+	sessionID     uint            // OnlineSession desta ligação (ver cluster.go), protegido por Hub.mu
+	sessionOpened chan struct{}   // Fechado depois de a OnlineSession ser gravada (ver Hub.connected)
+	topics        map[string]bool // Tópicos subscritos (ver topics.go), protegido por Hub.mu
+	seq           uint64          // Seq da última mensagem da fila enviada, protegido por Hub.seqMu
+
+	// Página ou posto indicados pelo cliente (ver presence.go), protegidos por Hub.mu.
+	page          string
+	station       string
+	pageChangedAt *time.Time
+}
+
+func newClient(conn *websocket.Conn) *Client {
+	client := &Client{
+		Conn:          conn,
+		ConnectedAt:   time.Now(),
+		send:          make(chan []byte, sendBufferSize),
+		sessionOpened: make(chan struct{}),
+		topics:        make(map[string]bool),
+	}
+	for _, topic := range defaultTopics {
+		client.topics[topic] = true
+	}
+	return client
+}
+
+// writePump envia as mensagens da fila do cliente e os pings, cada escrita com o seu prazo.
+// Termina quando o hub fecha o canal send (cliente removido ou lento) ou quando uma escrita
+// falha; em ambos os casos fecha a ligação, o que faz readPump terminar também.
+func (c *Client) writePump(h *Hub) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				h.metrics.writeErrors.Add(1)
+				log.Printf("Erro ao enviar mensagem para %s: %v", c.Username, err)
+				return
+			}
+			h.metrics.messagesSent.Add(1)
+
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				h.metrics.writeErrors.Add(1)
+				log.Printf("Erro ao enviar ping para %s: %v", c.Username, err)
+				return
+			}
+		}
+	}
+}
+
+// readPump lê as mensagens do cliente até a ligação falhar ou ser fechada
+// e então retira o cliente do hub.
+func (c *Client) readPump(h *Hub) {
+	defer func() {
+		h.unregister <- c
+		c.Conn.Close()
+	}()
+	c.Conn.SetReadLimit(maxInboundSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	for {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("Erro de leitura WebSocket (cliente %s): %v", c.Username, err)
+			}
+			return
+		}
+		h.handleInbound(c, data)
+	}
+}
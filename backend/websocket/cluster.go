@@ -0,0 +1,284 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Com várias instâncias no Cloud Run cada hub só conhece os seus clientes. As alterações
+// que chegam a uma instância (deltas da fila, alertas, utilizadores, presença, avisos, sessões terminadas) são
+// publicadas com NOTIFY no canal clusterChannel; cada instância faz LISTEN no mesmo canal
+// e reenvia as mensagens das outras instâncias aos seus clientes. Os números de sequência
+// continuam a ser de cada hub: uma instância que recebe um delta remoto atribui-lhe o seu Seq.
+
+const (
+	clusterChannel = "fifo_ws"
+
+	// maxNotifyPayload fica abaixo do limite de 8000 bytes do NOTIFY do Postgres.
+	maxNotifyPayload = 7900
+
+	// presenceHeartbeat é o intervalo de renovação das OnlineSession da instância;
+	// sessões sem renovação há mais de presenceTTL são consideradas de uma instância terminada.
+	presenceHeartbeat = 30 * time.Second
+	presenceTTL       = 3 * presenceHeartbeat
+)
+
+// Tipos de mensagem trocados entre instâncias.
+const (
+	clusterQueueDelta   = "queue_delta"
+	clusterSLAAlert     = "sla_alert"
+	clusterAlertRule    = "alert_rule"
+	clusterUser         = "user_changed"
+	clusterPresence     = "presence"
+	clusterAnnouncement = "announcement"
+	clusterDisconnect   = "disconnect"
+)
+
+// instanceID identifica esta instância nas mensagens e nas OnlineSession.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// clusterMessage é o corpo de cada NOTIFY.
+type clusterMessage struct {
+	Origin string          `json:"origin"`
+	Kind   string          `json:"kind"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// presenceUser são os dados de um utilizador alterado que as outras instâncias precisam
+// para atualizar os seus clientes (sem o resto do models.User).
+type presenceUser struct {
+	ID       uint   `json:"id"`
+	FullName string `json:"fullName"`
+	Role     string `json:"role"`
+	Sector   string `json:"sector"`
+}
+
+// publish envia uma mensagem às outras instâncias. Falhas são apenas registadas:
+// os clientes locais já foram atualizados e os remotos recuperam no próximo snapshot.
+func (h *Hub) publish(kind string, data interface{}) {
+	message := clusterMessage{Origin: instanceID, Kind: kind}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("Erro ao serializar mensagem %s para as outras instâncias: %v", kind, err)
+			return
+		}
+		message.Data = raw
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Erro ao serializar mensagem %s para as outras instâncias: %v", kind, err)
+		return
+	}
+	if len(payload) > maxNotifyPayload {
+		log.Printf("Mensagem %s demasiado grande para NOTIFY (%d bytes); não enviada às outras instâncias.", kind, len(payload))
+		return
+	}
+	if err := initializers.DB.Exec("SELECT pg_notify(?, ?)", clusterChannel, string(payload)).Error; err != nil {
+		log.Printf("Erro ao publicar mensagem %s para as outras instâncias: %v", kind, err)
+		return
+	}
+	h.metrics.clusterPublished.Add(1)
+}
+
+// Listen mantém uma ligação dedicada ao Postgres com LISTEN no canal do cluster e
+// entrega ao hub as mensagens das outras instâncias. Se a ligação cair, volta a ligar
+// e envia um snapshot novo a todos os clientes, porque as mensagens entretanto
+// publicadas se perderam.
+func (h *Hub) Listen() {
+	backoff := time.Second
+	connected := false
+	for {
+		err := h.listen(func() {
+			backoff = time.Second
+			if connected {
+				log.Println("Ligação LISTEN do WebSocket restabelecida; a reenviar o estado aos clientes.")
+				h.resyncAll()
+			}
+			connected = true
+		})
+		log.Printf("Ligação LISTEN do WebSocket perdida: %v. Nova tentativa em %s.", err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// listen liga, faz LISTEN e processa as notificações até a ligação falhar.
+func (h *Hub) listen(onListening func()) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, config.AppConfig.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+clusterChannel); err != nil {
+		return err
+	}
+	onListening()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		h.handleClusterMessage([]byte(notification.Payload))
+	}
+}
+
+// handleClusterMessage reenvia aos clientes locais uma mensagem de outra instância.
+func (h *Hub) handleClusterMessage(payload []byte) {
+	var message clusterMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Printf("Mensagem inválida no canal %s: %v", clusterChannel, err)
+		return
+	}
+	if message.Origin == instanceID {
+		return
+	}
+	h.metrics.clusterReceived.Add(1)
+
+	switch message.Kind {
+	case clusterQueueDelta:
+		var delta PackageDeltaMessage
+		if err := json.Unmarshal(message.Data, &delta); err == nil {
+			h.broadcastQueueDelta(delta)
+		}
+	case clusterSLAAlert:
+		var change services.SLAAlertChange
+		if err := json.Unmarshal(message.Data, &change); err == nil {
+			h.broadcastSLAAlerts([]services.SLAAlertChange{change})
+		}
+	case clusterAlertRule:
+		var event models.AlertRuleEvent
+		if err := json.Unmarshal(message.Data, &event); err == nil {
+			h.broadcastAlertRuleEvents([]models.AlertRuleEvent{event})
+		}
+	case clusterUser:
+		var user presenceUser
+		if err := json.Unmarshal(message.Data, &user); err == nil {
+			h.refreshUser(user)
+		}
+	case clusterPresence:
+		h.broadcastOnlineUsers()
+	case clusterAnnouncement:
+		var announcement AnnouncementMessage
+		if err := json.Unmarshal(message.Data, &announcement); err == nil {
+			h.broadcastAnnouncement(announcement)
+		}
+	case clusterDisconnect:
+		var request disconnectRequest
+		if err := json.Unmarshal(message.Data, &request); err == nil {
+			// A revogação do token já está gravada: é lida antes de fechar, para impedir que
+			// o cliente volte a ligar a esta instância com a cópia antiga
+			services.RefreshTokenRevocations()
+			h.disconnectUser(request)
+		}
+	default:
+		log.Printf("Tipo de mensagem desconhecido no canal %s: %s", clusterChannel, message.Kind)
+	}
+}
+
+// resyncAll envia um snapshot da fila e a lista de utilizadores online a todos os clientes locais.
+func (h *Hub) resyncAll() {
+	h.mu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		h.sendQueueSnapshot(client)
+	}
+	h.broadcastOnlineUsers()
+}
+
+// openSession regista a ligação na tabela OnlineSession.
+func (h *Hub) openSession(client *Client) {
+	now := services.GetBrasiliaTime()
+	session := models.OnlineSession{
+		InstanceID:  instanceID,
+		UserID:      client.UserID,
+		Username:    client.Username,
+		FullName:    client.FullName,
+		Role:        client.Role,
+		Sector:      client.Sector,
+		UserAgent:   client.UserAgent,
+		IP:          client.IP,
+		ConnectedAt: now,
+		LastSeenAt:  now,
+	}
+	h.mu.Lock()
+	session.Page, session.Station, session.PageChangedAt = client.page, client.station, client.pageChangedAt
+	h.mu.Unlock()
+	if err := initializers.DB.Create(&session).Error; err != nil {
+		log.Printf("Erro ao registar sessão WebSocket de %s: %v", client.Username, err)
+		return
+	}
+
+	// Uma mensagem "presence" recebida durante a gravação ainda não foi guardada na sessão
+	h.mu.Lock()
+	client.sessionID = session.ID
+	page, station, changedAt := client.page, client.station, client.pageChangedAt
+	h.mu.Unlock()
+	if page != session.Page || station != session.Station {
+		err := initializers.DB.Model(&session).Updates(map[string]interface{}{"page": page, "station": station, "page_changed_at": changedAt}).Error
+		if err != nil {
+			log.Printf("Erro ao atualizar presença de %s: %v", client.Username, err)
+		}
+	}
+}
+
+// closeSession remove a ligação da tabela OnlineSession.
+func (h *Hub) closeSession(client *Client) {
+	h.mu.Lock()
+	sessionID := client.sessionID
+	h.mu.Unlock()
+	if sessionID == 0 {
+		return
+	}
+	if err := initializers.DB.Delete(&models.OnlineSession{}, sessionID).Error; err != nil {
+		log.Printf("Erro ao remover sessão WebSocket de %s: %v", client.Username, err)
+	}
+}
+
+// renewSessions renova as sessões desta instância e remove as de instâncias que deixaram
+// de as renovar. Se alguma for removida, a lista de utilizadores online é atualizada em todas.
+func (h *Hub) renewSessions() {
+	now := services.GetBrasiliaTime()
+	if err := initializers.DB.Model(&models.OnlineSession{}).Where("instance_id = ?", instanceID).Update("last_seen_at", now).Error; err != nil {
+		log.Printf("Erro ao renovar sessões WebSocket: %v", err)
+		return
+	}
+	result := initializers.DB.Where("last_seen_at < ?", now.Add(-presenceTTL)).Delete(&models.OnlineSession{})
+	if result.Error != nil {
+		log.Printf("Erro ao remover sessões WebSocket expiradas: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("%d sessões WebSocket de instâncias terminadas removidas.", result.RowsAffected)
+		h.publish(clusterPresence, nil)
+		h.broadcastOnlineUsers()
+	}
+}
@@ -0,0 +1,140 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fifo-system/backend/middleware"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Os scanners podem fazer as operações da fila pela própria ligação WebSocket, em vez de
+// um pedido HTTPS por leitura. Cada comando leva um requestId escolhido pelo cliente e a
+// resposta ("command_result") volta pela mesma ligação com o mesmo requestId:
+//
+//	{"type": "entry", "requestId": "a1", "trackingId": "CG000123", "buffer": "RTS", "rua": "R01", "profile": "P"}
+//	{"type": "exit",  "requestId": "a2", "trackingId": "CG000123"}
+//	{"type": "move",  "requestId": "a3", "packageId": 42, "rua": "R02"} (ou "trackingId" em vez de "packageId")
+//	{"type": "scan",  "requestId": "a4", "trackingId": "CG000123"}
+//
+// As permissões são as das rotas HTTP equivalentes, verificadas com as do token da ligação.
+// Os comandos de uma ligação são executados pela ordem em que chegam.
+
+const maxRequestIDLength = 64
+
+// commandMessage é o corpo de um comando recebido.
+type commandMessage struct {
+	Type       string `json:"type"`
+	RequestID  string `json:"requestId"`
+	TrackingID string `json:"trackingId"`
+	Buffer     string `json:"buffer"`
+	Rua        string `json:"rua"`
+	Profile    string `json:"profile"`
+	PackageID  uint   `json:"packageId"`
+}
+
+// CommandResultMessage é a resposta a um comando. Status segue os códigos HTTP da rota equivalente.
+type CommandResultMessage struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"requestId"`
+	Command   string      `json:"command"`
+	OK        bool        `json:"ok"`
+	Status    int         `json:"status"`
+	Message   string      `json:"message,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// command descreve um comando: a permissão exigida e a operação, que devolve a mensagem
+// de sucesso e os dados da resposta.
+type command struct {
+	permission string
+	run        func(user models.User, message commandMessage) (string, interface{}, error)
+}
+
+var commands = map[string]command{
+	"entry": {permission: "MANAGE_FIFO", run: func(user models.User, message commandMessage) (string, interface{}, error) {
+		if message.TrackingID == "" || message.Buffer == "" || message.Rua == "" {
+			return "", nil, &services.PackageError{Status: http.StatusBadRequest, Message: "Input inválido. TrackingID, Buffer e Rua são necessários."}
+		}
+		pkg, err := services.EnterPackage(user, services.PackageEntryInput{
+			TrackingID: message.TrackingID,
+			Buffer:     message.Buffer,
+			Rua:        message.Rua,
+			Profile:    message.Profile,
+		})
+		return "Entrada do item registrada com sucesso.", pkg, err
+	}},
+	"exit": {permission: "MANAGE_FIFO", run: func(user models.User, message commandMessage) (string, interface{}, error) {
+		if message.TrackingID == "" {
+			return "", nil, &services.PackageError{Status: http.StatusBadRequest, Message: "O Tracking ID é obrigatório."}
+		}
+		pkg, err := services.ExitPackage(user, message.TrackingID)
+		return "Item removido da fila com sucesso.", pkg, err
+	}},
+	"move": {permission: "MOVE_PACKAGE", run: func(user models.User, message commandMessage) (string, interface{}, error) {
+		if message.Rua == "" || (message.PackageID == 0 && message.TrackingID == "") {
+			return "", nil, &services.PackageError{Status: http.StatusBadRequest, Message: "O campo 'rua' e o 'packageId' ou 'trackingId' são obrigatórios."}
+		}
+		pkg, _, err := services.MovePackage(user, message.PackageID, message.TrackingID, message.Rua)
+		return "Item movido com sucesso.", pkg, err
+	}},
+	"scan": {permission: "MANAGE_FIFO", run: func(user models.User, message commandMessage) (string, interface{}, error) {
+		if message.TrackingID == "" {
+			return "", nil, &services.PackageError{Status: http.StatusBadRequest, Message: "O Tracking ID é obrigatório."}
+		}
+		result, err := services.ScanPackage(message.TrackingID)
+		return "", result, err
+	}},
+}
+
+func init() {
+	for name := range commands {
+		inboundHandlers[name] = func(h *Hub, c *Client, message inboundMessage) { h.runCommand(c, message) }
+	}
+}
+
+// runCommand valida e executa um comando e envia a resposta ao cliente.
+func (h *Hub) runCommand(c *Client, inbound inboundMessage) {
+	var message commandMessage
+	if err := json.Unmarshal(inbound.raw, &message); err != nil {
+		h.sendTo(c, ErrorMessage{Type: "error", RequestID: inbound.RequestID, Error: "Comando inválido."})
+		return
+	}
+	if inbound.RequestID == "" {
+		h.sendTo(c, ErrorMessage{Type: "error", Error: "Os comandos precisam de um requestId (até 64 caracteres)."})
+		return
+	}
+	message.TrackingID = strings.TrimSpace(message.TrackingID)
+	result := CommandResultMessage{Type: "command_result", RequestID: message.RequestID, Command: message.Type}
+
+	cmd := commands[message.Type]
+	if !middleware.HasPermission(c.user, cmd.permission) {
+		result.Status, result.Error = http.StatusForbidden, "Permissões insuficientes para aceder a este recurso."
+		h.sendTo(c, result)
+		return
+	}
+
+	text, data, err := cmd.run(c.user, message)
+	if err != nil {
+		var packageErr *services.PackageError
+		if errors.As(err, &packageErr) {
+			result.Status, result.Error = packageErr.Status, packageErr.Message
+		} else {
+			log.Printf("Erro no comando WebSocket %s de %s: %v", message.Type, c.Username, err)
+			result.Status, result.Error = http.StatusInternalServerError, "Erro interno ao processar o comando."
+		}
+		h.sendTo(c, result)
+		return
+	}
+
+	result.OK, result.Status, result.Message, result.Data = true, http.StatusOK, text, data
+	h.sendTo(c, result)
+	if message.Type == "scan" {
+		// As outras operações chegam à presença pelos eventos da fila (ver HandleEvent)
+		h.recordActivity(c.UserID, services.GetBrasiliaTime())
+	}
+}
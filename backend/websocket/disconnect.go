@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fifo-system/backend/services"
+	"log"
+	"time"
+)
+
+// SessionTerminatedMessage é a mensagem "session_terminated", enviada a todas as ligações de
+// um utilizador cuja sessão foi terminada por um líder, imediatamente antes de as fechar.
+type SessionTerminatedMessage struct {
+	Type         string    `json:"type"`
+	Reason       string    `json:"reason"`
+	By           string    `json:"by"`
+	TerminatedAt time.Time `json:"terminatedAt"`
+}
+
+// disconnectRequest é enviado às outras instâncias para fecharem as ligações do utilizador.
+type disconnectRequest struct {
+	UserID  uint                     `json:"userId"`
+	Message SessionTerminatedMessage `json:"message"`
+}
+
+// DisconnectUser envia o motivo e fecha as ligações do utilizador em todas as instâncias.
+func (h *Hub) DisconnectUser(userID uint, reason, by string) {
+	request := disconnectRequest{
+		UserID:  userID,
+		Message: SessionTerminatedMessage{Type: "session_terminated", Reason: reason, By: by, TerminatedAt: services.GetBrasiliaTime()},
+	}
+	h.disconnectUser(request)
+	h.publish(clusterDisconnect, request)
+}
+
+// disconnectUser fecha as ligações locais do utilizador. A mensagem fica na fila de envio
+// antes do fecho, por isso writePump envia-a (e as anteriores) antes da mensagem de fecho.
+func (h *Hub) disconnectUser(request disconnectRequest) {
+	message, err := json.Marshal(request.Message)
+	if err != nil {
+		log.Printf("Erro ao serializar fim de sessão: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	closed := 0
+	for client := range h.clients {
+		if client.UserID != request.UserID {
+			continue
+		}
+		if h.enqueue(client, message) {
+			h.removeClient(client)
+		}
+		closed++
+	}
+	if closed > 0 {
+		log.Printf("Sessão do utilizador %d terminada por %s: %d ligações fechadas.", request.UserID, request.Message.By, closed)
+	}
+}
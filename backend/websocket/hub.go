@@ -1,132 +1,188 @@
 package websocket
 
 import (
-	"database/sql" // <-- ADICIONAR IMPORT
 	"encoding/json"
+	"errors"
+	"fifo-system/backend/config"
+	"fifo-system/backend/events"
 	"fifo-system/backend/initializers"
 	"fifo-system/backend/models"
 	"fifo-system/backend/services"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
 )
 
-// Client representa um utilizador conectado via WebSocket.
-type Client struct {
-	Conn     *websocket.Conn
-	UserID   uint
-	FullName string
-	Username string
-	Role     string
-	Sector   string
-}
-
 // Hub mantém o conjunto de clientes ativos.
 type Hub struct {
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.Mutex
-}
-
-// --- Estrutura para a mensagem de atualização da fila ---
-type QueueUpdateMessage struct {
-	Type         string           `json:"type"`
-	Queue        []models.Package `json:"queue"`
-	Backlog      int64            `json:"backlog"`
-	BacklogCount int64            `json:"backlogCount"` // Contagem de itens
-	BacklogValue int64            `json:"backlogValue"` // Soma dos valores (P=250, M=80, G=10)
-	BufferCounts map[string]int64 `json:"bufferCounts"` // Contagem por buffer
-	BufferValues map[string]int64 `json:"bufferValues"` // Soma de valores por buffer
-	BufferAvgTimes map[string]float64 `json:"bufferAvgTimes"` // Tempo médio (só RTS e EHA)
-	
+	metrics    hubCounters
+
+	// seqMu ordena o fluxo da fila: cada delta recebe o número de sequência seguinte
+	// de cada cliente e nenhum snapshot é enviado enquanto um delta está a ser enviado (ver queue.go).
+	seqMu sync.Mutex
+	// queueSeq e queueHistory (protegidos por seqMu) numeram os deltas da fila de todo o hub
+	// e guardam os mais recentes, para os reenviar depois de um snapshot (ver sendQueueSnapshot).
+	queueSeq     uint64
+	queueHistory []queueHistoryEntry
+
+	// statsMu protege o agendamento do "stats_changed" agrupado (ver flushQueueStats).
+	statsMu        sync.Mutex
+	statsDirty     bool
+	statsScheduled bool
+
+	// public é o fluxo SSE dos ecrãs em modo convidado (ver stream.go).
+	public publicStream
+
+	// Limites das ligações (ver limits.go). conns e userConns são protegidos por mu.
+	limiter       upgradeLimiter
+	streamLimiter upgradeLimiter // Pedidos ao fluxo público
+	conns         int
+	userConns     map[uint]int
+
+	// presenceDirty indica que houve ações desde o último heartbeat (ver recordActivity).
+	presenceDirty atomic.Bool
 }
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin:     checkOrigin,
 }
 
 var H = Hub{
 	clients:    make(map[*Client]bool),
 	register:   make(chan *Client),
 	unregister: make(chan *Client),
+	public:     publicStream{subscribers: make(map[*publicSubscriber]bool)},
+	userConns:  make(map[uint]int),
 }
 
+// Run regista e retira os clientes. Só altera o estado em memória: a gravação das sessões
+// (OnlineSession), o snapshot da fila e a lista de utilizadores online vão para uma goroutine
+// por ligação, para que uma base de dados lenta não atrase as outras ligações.
 func (h *Hub) Run() {
+	go h.runHeartbeat()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
+			h.metrics.connections.Add(1)
 			log.Printf("Cliente conectado: %s", client.Username)
-			h.broadcastOnlineUsers()
-			h.sendInitialQueueState(client)
+			go h.connected(client)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Conn.Close()
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
+			h.release(client.UserID)
 			log.Printf("Cliente desconectado: %s", client.Username)
+			go h.disconnected(client)
+		}
+	}
+}
+
+// connected envia o snapshot da fila ao cliente, grava a sua sessão e atualiza a lista de
+// utilizadores online em todas as instâncias.
+func (h *Hub) connected(client *Client) {
+	defer close(client.sessionOpened)
+	h.sendQueueSnapshot(client)
+	h.openSession(client)
+	h.publish(clusterPresence, nil)
+	h.broadcastOnlineUsers()
+}
+
+// disconnected remove a sessão do cliente, depois de connected a ter gravado, e atualiza a
+// lista de utilizadores online em todas as instâncias.
+func (h *Hub) disconnected(client *Client) {
+	<-client.sessionOpened
+	h.closeSession(client)
+	h.publish(clusterPresence, nil)
+	h.broadcastOnlineUsers()
+}
+
+// runHeartbeat renova as sessões desta instância e, se tiver havido ações desde o último
+// heartbeat, reenvia a lista de utilizadores online.
+func (h *Hub) runHeartbeat() {
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+	for range heartbeat.C {
+		h.renewSessions()
+		if h.presenceDirty.Swap(false) {
+			h.publish(clusterPresence, nil)
 			h.broadcastOnlineUsers()
 		}
 	}
 }
 
-func (h *Hub) sendInitialQueueState(client *Client) {
-	// --- ASSINATURA DA FUNÇÃO MUDOU ---
-	queue, backlogCount, backlogValue, bufferCounts, bufferValues, bufferAvgTimes := getCurrentQueueState()
-	messageData := QueueUpdateMessage{
-		Type:           "queue_update",
-		Queue:          queue,
-		BacklogCount:   backlogCount,
-		BacklogValue:   backlogValue,
-		BufferCounts:   bufferCounts,
-		BufferValues:   bufferValues,
-		BufferAvgTimes: bufferAvgTimes, // NOVO
+// removeClient retira o cliente do hub e fecha a sua fila de envio, o que termina writePump.
+// Deve ser chamado com h.mu bloqueado; um cliente já removido é ignorado.
+func (h *Hub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
 	}
-	// ... (resto da função inalterado) ...
-	message, err := json.Marshal(messageData)
-	if err != nil {
-		log.Printf("Erro ao serializar estado inicial da fila: %v", err)
-		return
+}
+
+// enqueue coloca uma mensagem na fila de envio do cliente sem bloquear. Se a fila estiver
+// cheia o cliente não está a acompanhar: é desligado e as mensagens pendentes descartadas
+// (ao voltar a ligar recebe um novo snapshot). Deve ser chamado com h.mu bloqueado.
+func (h *Hub) enqueue(client *Client, message []byte) bool {
+	if _, ok := h.clients[client]; !ok {
+		return false
 	}
+	select {
+	case client.send <- message:
+		return true
+	default:
+		h.metrics.slowClients.Add(1)
+		h.metrics.messagesDropped.Add(uint64(len(client.send)) + 1)
+		log.Printf("Cliente lento desligado: %s (%d mensagens pendentes)", client.Username, len(client.send))
+		h.removeClient(client)
+		return false
+	}
+}
 
+// broadcast envia as mensagens, pela ordem indicada, aos clientes subscritos ao tópico.
+func (h *Hub) broadcast(topic string, messages ...[]byte) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	if _, ok := h.clients[client]; ok {
-		err := client.Conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Printf("Erro ao enviar estado inicial da fila para %s: %v", client.Username, err)
+	for client := range h.clients {
+		if !client.subscribed(topic) {
+			continue
+		}
+		for _, message := range messages {
+			if !h.enqueue(client, message) {
+				break
+			}
 		}
 	}
 }
 
+// broadcastOnlineUsers envia aos administradores e líderes a lista de utilizadores online de
+// todas as instâncias (tabela OnlineSession). Se a tabela não puder ser lida, envia apenas as locais.
 func (h *Hub) broadcastOnlineUsers() {
+	onlineUsers, err := h.OnlineUsers()
+	if err != nil {
+		log.Printf("Erro ao buscar sessões WebSocket: %v", err)
+	}
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	var onlineUsers []map[string]interface{}
-	for client := range h.clients {
-		onlineUsers = append(onlineUsers, map[string]interface{}{
-			"fullName": client.FullName,
-			"id":       client.UserID,
-			"username": client.Username,
-			"role":     client.Role,
-			"sector":   client.Sector,
-		})
+	if err != nil {
+		onlineUsers = aggregateSessions(h.localSessions())
 	}
 
 	message, _ := json.Marshal(map[string]interface{}{
@@ -135,184 +191,170 @@ func (h *Hub) broadcastOnlineUsers() {
 	})
 
 	for client := range h.clients {
-		if client.Role == "admin" || client.Role == "leader" {
-			err := client.Conn.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				log.Printf("Erro ao enviar lista de utilizadores online para %s: %v", client.Username, err)
-			}
+		if (client.Role == "admin" || client.Role == "leader") && client.subscribed(TopicPresence) {
+			h.enqueue(client, message)
 		}
 	}
 }
 
-func getCurrentQueueState() ([]models.Package, int64, int64, map[string]int64, map[string]int64, map[string]float64) {
-	var packages []models.Package
-	var backlogCount int64 = 0
-	var backlogValue int64 = 0
-	bufferCounts := make(map[string]int64)
-	bufferValues := make(map[string]int64)
-	bufferTotalSeconds := make(map[string]float64) // Para calcular a média
-	bufferAvgTimes := make(map[string]float64)
-	now := services.GetBrasiliaTime()
-
-	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
-		// Busca todos os pacotes ativos
-		if err := tx.Where("buffer <> ?", "PENDENTE").Order("entry_timestamp asc").Find(&packages).Error; err != nil {
-			return err
+// HandleEvent é o subscritor "websocket" do barramento de eventos: envia um delta da fila
+// a cada entrada, saída ou movimentação, atualiza a lista de utilizadores online quando um
+// utilizador é alterado e envia as alterações dos alertas e das regras de alerta.
+// Cada alteração é também publicada para as outras instâncias.
+func (h *Hub) HandleEvent(e events.Event) {
+	switch e := e.(type) {
+	case events.PackageEntered:
+		pkg := e.Package
+		h.publishQueueDelta(PackageDeltaMessage{Type: "package_added", PackageID: pkg.ID, TrackingID: pkg.TrackingID, Buffer: pkg.Buffer, Rua: pkg.Rua, Package: &pkg})
+		h.recordActivity(e.Record.UserID, e.Record.OccurredAt)
+	case events.PackageExited:
+		h.publishQueueDelta(PackageDeltaMessage{Type: "package_removed", PackageID: e.Package.ID, TrackingID: e.Package.TrackingID, Buffer: e.Package.Buffer, Rua: e.Package.Rua})
+		h.recordActivity(e.Record.UserID, e.Record.OccurredAt)
+	case events.PackageMoved:
+		pkg := e.Package
+		h.publishQueueDelta(PackageDeltaMessage{Type: "package_moved", PackageID: pkg.ID, TrackingID: pkg.TrackingID, Buffer: pkg.Buffer, FromRua: e.FromRua, Rua: pkg.Rua, Package: &pkg})
+		h.recordActivity(e.Record.UserID, e.Record.OccurredAt)
+	case events.UserChanged:
+		user := presenceUser{ID: e.User.ID, FullName: e.User.FullName, Role: e.User.Role.Name, Sector: e.User.Sector}
+		err := initializers.DB.Model(&models.OnlineSession{}).Where("user_id = ?", user.ID).
+			Updates(map[string]interface{}{"full_name": user.FullName, "role": user.Role, "sector": user.Sector}).Error
+		if err != nil {
+			log.Printf("Erro ao atualizar sessões WebSocket de %s: %v", e.User.Username, err)
 		}
+		h.publish(clusterUser, user)
+		h.refreshUser(user)
+	case events.SLAAlertChanged:
+		change := services.SLAAlertChange{Event: e.Event, Alert: e.Alert}
+		h.broadcastSLAAlerts([]services.SLAAlertChange{change})
+		h.publish(clusterSLAAlert, change)
+	case events.AlertRuleChanged:
+		h.broadcastAlertRuleEvents([]models.AlertRuleEvent{e.Record})
+		h.publish(clusterAlertRule, e.Record)
+	}
+}
 
-		// Inicializa mapas
-		bufferCounts["RTS"], bufferCounts["EHA"], bufferCounts["SAL"] = 0, 0, 0
-		bufferValues["RTS"], bufferValues["EHA"], bufferValues["SAL"] = 0, 0, 0
-		bufferTotalSeconds["RTS"], bufferTotalSeconds["EHA"] = 0.0, 0.0 // SAL não precisa
-		bufferAvgTimes["RTS"], bufferAvgTimes["EHA"] = 0.0, 0.0         // SAL não terá
-
-		for _, pkg := range packages {
-			// Calcula tempo de permanência se o timestamp não for zero
-			var durationSeconds float64 = 0
-			if !pkg.EntryTimestamp.IsZero() {
-				durationSeconds = now.Sub(pkg.EntryTimestamp).Seconds()
-			}
-
-			// Conta e Soma para BACKLOG (Excluindo SAL)
-			if pkg.Buffer != "SAL" {
-				backlogCount++
-				backlogValue += int64(pkg.ProfileValue)
-			}
+// publishQueueDelta envia o delta aos clientes locais e às outras instâncias.
+func (h *Hub) publishQueueDelta(delta PackageDeltaMessage) {
+	h.broadcastQueueDelta(delta)
+	h.publish(clusterQueueDelta, delta)
+}
 
-			// Conta, Soma e Tempo Total por BUFFER
-			switch pkg.Buffer {
-			case "RTS":
-				bufferCounts["RTS"]++
-				bufferValues["RTS"] += int64(pkg.ProfileValue)
-				bufferTotalSeconds["RTS"] += durationSeconds
-			case "EHA":
-				bufferCounts["EHA"]++
-				bufferValues["EHA"] += int64(pkg.ProfileValue)
-				bufferTotalSeconds["EHA"] += durationSeconds
-			case "SAL":
-				bufferCounts["SAL"]++
-				// bufferValues["SAL"] permanece 0
-				// bufferTotalSeconds["SAL"] não é calculado
-			}
+// refreshUser atualiza o nome, papel e setor das ligações locais do utilizador
+// e volta a enviar a lista de utilizadores online.
+func (h *Hub) refreshUser(user presenceUser) {
+	h.mu.Lock()
+	for client := range h.clients {
+		if client.UserID == user.ID {
+			client.FullName = user.FullName
+			client.Role = user.Role
+			client.Sector = user.Sector
 		}
+	}
+	h.mu.Unlock()
 
-		// Calcula Tempo Médio
-		if bufferCounts["RTS"] > 0 {
-			bufferAvgTimes["RTS"] = bufferTotalSeconds["RTS"] / float64(bufferCounts["RTS"])
-		}
-		if bufferCounts["EHA"] > 0 {
-			bufferAvgTimes["EHA"] = bufferTotalSeconds["EHA"] / float64(bufferCounts["EHA"])
-		}
+	h.broadcastOnlineUsers()
+}
 
-		return nil
-	}, &sql.TxOptions{ReadOnly: true})
+// SLAAlertMessage é a mensagem "sla_alert", enviada quando um alerta de SLA é aberto,
+// escalado, reconhecido ou resolvido.
+type SLAAlertMessage struct {
+	Type  string          `json:"type"`
+	Event string          `json:"event"` // opened, escalated, acknowledged ou resolved
+	Alert models.SLAAlert `json:"alert"`
+}
 
-	if err != nil {
-		log.Printf("Erro ao buscar estado da fila no DB: %v", err)
-		// Retorna zero para todos os valores em caso de erro
-		emptyCounts := map[string]int64{"RTS": 0, "EHA": 0, "SAL": 0}
-		emptyValues := map[string]int64{"RTS": 0, "EHA": 0, "SAL": 0}
-		emptyAvgTimes := map[string]float64{"RTS": 0.0, "EHA": 0.0}
-		return []models.Package{}, 0, 0, emptyCounts, emptyValues, emptyAvgTimes
+func (h *Hub) broadcastSLAAlerts(changes []services.SLAAlertChange) {
+	if len(changes) == 0 {
+		return
 	}
 
-	return packages, backlogCount, backlogValue, bufferCounts, bufferValues, bufferAvgTimes
+	messages := make([][]byte, 0, len(changes))
+	for _, change := range changes {
+		message, err := json.Marshal(SLAAlertMessage{Type: "sla_alert", Event: change.Event, Alert: change.Alert})
+		if err != nil {
+			log.Printf("Erro ao serializar alerta de SLA: %v", err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	h.broadcast(TopicAlerts, messages...)
 }
 
-func (h *Hub) BroadcastQueueUpdate() {
-	// --- ASSINATURA DA FUNÇÃO MUDOU ---
-	queue, backlogCount, backlogValue, bufferCounts, bufferValues, bufferAvgTimes := getCurrentQueueState()
-	messageData := QueueUpdateMessage{
-		Type:           "queue_update",
-		Queue:          queue,
-		BacklogCount:   backlogCount,
-		BacklogValue:   backlogValue,
-		BufferCounts:   bufferCounts,
-		BufferValues:   bufferValues,
-		BufferAvgTimes: bufferAvgTimes, // NOVO
-	}
+// AlertRuleMessage é a mensagem "alert_rule", enviada quando uma regra de alerta
+// dispara ou volta ao normal.
+type AlertRuleMessage struct {
+	Type  string                `json:"type"`
+	Event models.AlertRuleEvent `json:"event"`
+}
 
-	message, err := json.Marshal(messageData)
-	if err != nil {
-		log.Printf("Erro ao serializar atualização da fila: %v", err)
+func (h *Hub) broadcastAlertRuleEvents(events []models.AlertRuleEvent) {
+	if len(events) == 0 {
 		return
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	for client := range h.clients {
-		err := client.Conn.WriteMessage(websocket.TextMessage, message)
+	messages := make([][]byte, 0, len(events))
+	for _, event := range events {
+		message, err := json.Marshal(AlertRuleMessage{Type: "alert_rule", Event: event})
 		if err != nil {
-			log.Printf("Erro ao enviar atualização da fila para %s: %v", client.Username, err)
+			log.Printf("Erro ao serializar evento de regra de alerta: %v", err)
+			continue
 		}
+		messages = append(messages, message)
 	}
-	log.Println("Atualização da fila enviada para todos os clientes.")
+
+	h.broadcast(TopicAlerts, messages...)
 }
 
 func ServeWs(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ip := c.ClientIP()
+	if !H.limiter.allow(ip, config.AppConfig.WSUpgradeRateLimit, time.Now()) {
+		H.reject(c.Request, ip, rejectRateLimit)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Demasiados pedidos de ligação. Tente novamente dentro de um minuto."})
+		return
+	}
+	if !checkOrigin(c.Request) {
+		H.reject(c.Request, ip, rejectOrigin)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Origem não permitida."})
+		return
+	}
+
+	// A ligação é autorizada por um ticket de uso único (POST /api/ws/ticket), e não pelo JWT,
+	// que ficaria registado nos logs dos proxies por ir no URL.
+	currentUser, err := services.RedeemWebSocketTicket(c.Query("ticket"))
 	if err != nil {
-		log.Printf("Falha no upgrade para WebSocket: %v", err)
+		if !errors.Is(err, services.ErrInvalidWebSocketTicket) {
+			log.Printf("Erro ao validar ticket do WebSocket: %v", err)
+		}
+		H.reject(c.Request, ip, rejectTicket)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Ticket do WebSocket inválido ou expirado."})
 		return
 	}
 
-	userInterface, exists := c.Get("user")
-	if !exists {
-		log.Println("Tentativa de conexão WS sem utilizador autenticado.")
-		conn.Close()
+	if reason := H.admit(currentUser.ID); reason != "" {
+		H.reject(c.Request, ip, reason, "userId", currentUser.ID, "username", currentUser.Username)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Limite de ligações em tempo real atingido."})
 		return
 	}
-	currentUser := userInterface.(models.User)
-
-	client := &Client{
-		Conn:     conn,
-		UserID:   currentUser.ID,
-		FullName: currentUser.FullName,
-		Username: currentUser.Username,
-		Role:     currentUser.Role.Name,
-		Sector:   currentUser.Sector,
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		H.release(currentUser.ID)
+		log.Printf("Falha no upgrade para WebSocket: %v", err)
+		return
 	}
 
+	client := newClient(conn)
+	client.user = currentUser
+	client.UserID = currentUser.ID
+	client.FullName = currentUser.FullName
+	client.Username = currentUser.Username
+	client.Role = currentUser.Role.Name
+	client.Sector = currentUser.Sector
+	client.UserAgent = truncatePresenceField(c.Request.UserAgent())
+	client.IP = ip
+
+	go client.writePump(&H)
 	H.register <- client
-
-	go func() {
-		defer func() {
-			H.unregister <- client
-			client.Conn.Close()
-		}()
-		client.Conn.SetReadLimit(maxMessageSize)
-		client.Conn.SetReadDeadline(time.Now().Add(pongWait))
-		client.Conn.SetPongHandler(func(string) error { client.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-
-		for {
-			_, _, err := client.Conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("Erro de leitura WebSocket (cliente %s): %v", client.Username, err)
-				}
-				break
-			}
-		}
-	}()
-
-	go func() {
-		ticker := time.NewTicker(pingPeriod)
-		defer func() {
-			ticker.Stop()
-		}()
-		for range ticker.C {
-			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Erro ao enviar ping para %s: %v", client.Username, err)
-				return
-			}
-		}
-	}()
+	go client.readPump(&H)
 }
-
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
-)
\ No newline at end of file
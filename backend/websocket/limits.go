@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"fifo-system/backend/config"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Antes do upgrade, cada pedido de ligação passa por quatro verificações, por esta ordem:
+//
+//	rate_limit    mais de WS_UPGRADE_RATE_LIMIT pedidos do mesmo IP por minuto (o IP do cliente
+//	              só vem do X-Forwarded-For com o pedido feito por um proxy de TRUSTED_PROXIES)
+//	origin        o cabeçalho Origin não é uma das origens do frontend (FRONTEND_URL)
+//	ticket        ticket inexistente, já usado ou expirado (ver ServeWs)
+//	user_limit    o utilizador já tem WS_MAX_CONNECTIONS_PER_USER ligações, somando todas as instâncias
+//	global_limit  a instância já tem WS_MAX_CONNECTIONS ligações
+//
+// As recusas são registadas com slog (motivo, IP, origem e utilizador) e contadas nas métricas do hub.
+// Os pedidos sem Origin (clientes que não são browsers, como os scanners) não são verificados
+// pela origem: o que se quer impedir é que outro site abra uma ligação a partir do browser.
+
+// Motivos de recusa de uma ligação.
+const (
+	rejectRateLimit   = "rate_limit"
+	rejectOrigin      = "origin"
+	rejectTicket      = "ticket"
+	rejectUserLimit   = "user_limit"
+	rejectGlobalLimit = "global_limit"
+)
+
+const upgradeRateWindow = time.Minute
+
+// upgradeLimiter conta os pedidos de ligação de cada IP numa janela fixa de upgradeRateWindow.
+type upgradeLimiter struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// allow regista um pedido do IP e indica se ainda está dentro do limite da janela atual.
+func (l *upgradeLimiter) allow(ip string, limit int, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts == nil || now.Sub(l.windowStart) >= upgradeRateWindow {
+		// Nova janela: os contadores anteriores deixam de contar, o que também liberta a memória
+		l.windowStart = now
+		l.counts = make(map[string]int)
+	}
+	l.counts[ip]++
+	return l.counts[ip] <= limit
+}
+
+// checkOrigin aceita pedidos sem Origin e os das origens do frontend configuradas.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	return allowedOrigin(origin, config.AppConfig.FrontendOrigins)
+}
+
+// allowedOrigin compara o esquema e o host (com porta) da origem com os de cada origem permitida.
+func allowedOrigin(origin string, allowed []string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	for _, candidate := range allowed {
+		expected, err := url.Parse(candidate)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(parsed.Scheme, expected.Scheme) && strings.EqualFold(parsed.Host, expected.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit reserva uma ligação para o utilizador, respeitando os limites por utilizador (em todas
+// as instâncias) e da instância. Devolve o motivo da recusa, ou "" se a ligação foi aceite;
+// nesse caso a reserva é libertada por release quando a ligação termina.
+func (h *Hub) admit(userID uint) string {
+	maxPerUser := config.AppConfig.WSMaxConnectionsPerUser
+	var remote int
+	if maxPerUser > 0 {
+		remote = remoteUserConnections(userID)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if maxPerUser > 0 && remote+h.userConns[userID] >= maxPerUser {
+		return rejectUserLimit
+	}
+	if max := config.AppConfig.WSMaxConnections; max > 0 && h.conns >= max {
+		return rejectGlobalLimit
+	}
+	h.conns++
+	h.userConns[userID]++
+	return ""
+}
+
+// remoteUserConnections conta as ligações do utilizador nas outras instâncias (tabela OnlineSession).
+// Se a tabela não puder ser lida, conta apenas as desta instância.
+func remoteUserConnections(userID uint) int {
+	var count int64
+	err := initializers.DB.Model(&models.OnlineSession{}).
+		Where("user_id = ? AND instance_id <> ? AND last_seen_at >= ?", userID, instanceID, services.GetBrasiliaTime().Add(-presenceTTL)).
+		Count(&count).Error
+	if err != nil {
+		log.Printf("Erro ao contar ligações WebSocket do utilizador #%d noutras instâncias: %v", userID, err)
+		return 0
+	}
+	return int(count)
+}
+
+// release liberta a reserva feita por admit.
+func (h *Hub) release(userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns--
+	if h.userConns[userID]--; h.userConns[userID] <= 0 {
+		delete(h.userConns, userID)
+	}
+}
+
+// reject regista e conta a recusa de um pedido de ligação.
+func (h *Hub) reject(r *http.Request, ip, reason string, attrs ...any) {
+	h.metrics.countRejection(reason)
+	attrs = append([]any{"reason", reason, "ip", ip, "origin", r.Header.Get("Origin")}, attrs...)
+	slog.Warn("Ligação WebSocket recusada", attrs...)
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hubCounters são os contadores acumulados desde o arranque do servidor.
+type hubCounters struct {
+	connections      atomic.Uint64
+	messagesSent     atomic.Uint64
+	messagesDropped  atomic.Uint64
+	slowClients      atomic.Uint64
+	writeErrors      atomic.Uint64
+	queueChanges     atomic.Uint64
+	statsBroadcasts  atomic.Uint64
+	clusterPublished atomic.Uint64
+	clusterReceived  atomic.Uint64
+
+	rejectionsMu sync.Mutex
+	rejections   map[string]uint64 // Pedidos de ligação recusados, por motivo (ver limits.go)
+}
+
+func (m *hubCounters) countRejection(reason string) {
+	m.rejectionsMu.Lock()
+	defer m.rejectionsMu.Unlock()
+	if m.rejections == nil {
+		m.rejections = make(map[string]uint64)
+	}
+	m.rejections[reason]++
+}
+
+// ClientMetrics descreve uma ligação ativa e a sua fila de envio.
+type ClientMetrics struct {
+	UserID      uint      `json:"userId"`
+	Username    string    `json:"username"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Pending     int       `json:"pending"` // Mensagens à espera de envio
+	Topics      []string  `json:"topics"`
+}
+
+// HubMetrics é o estado do hub devolvido por GET /api/management/ws/metrics.
+type HubMetrics struct {
+	InstanceID              string            `json:"instanceId"`
+	ConnectedClients        int               `json:"connectedClients"`
+	TotalConnections        uint64            `json:"totalConnections"`
+	MessagesSent            uint64            `json:"messagesSent"`
+	MessagesDropped         uint64            `json:"messagesDropped"`         // Mensagens descartadas de clientes lentos
+	SlowClientsDisconnected uint64            `json:"slowClientsDisconnected"` // Clientes desligados por encherem a fila
+	WriteErrors             uint64            `json:"writeErrors"`
+	QueueChanges            uint64            `json:"queueChanges"`     // Deltas da fila enviados
+	StatsBroadcasts         uint64            `json:"statsBroadcasts"`  // Cálculos de estatísticas (agrupados por janela)
+	ClusterPublished        uint64            `json:"clusterPublished"` // Mensagens publicadas para as outras instâncias
+	ClusterReceived         uint64            `json:"clusterReceived"`  // Mensagens recebidas das outras instâncias
+	SendBufferSize          int               `json:"sendBufferSize"`
+	PublicStreamClients     int               `json:"publicStreamClients"` // Ligações ao fluxo público /public/stream
+	PublicStreamDropped     uint64            `json:"publicStreamDropped"` // Ligações ao fluxo público desligadas por não acompanharem
+	RejectedConnections     map[string]uint64 `json:"rejectedConnections"` // Pedidos de ligação recusados, por motivo
+	Clients                 []ClientMetrics   `json:"clients"`
+}
+
+// Metrics devolve os contadores do hub e as ligações ativas, as mais atrasadas primeiro.
+func (h *Hub) Metrics() HubMetrics {
+	h.mu.Lock()
+	clients := make([]ClientMetrics, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, ClientMetrics{
+			UserID:      client.UserID,
+			Username:    client.Username,
+			ConnectedAt: client.ConnectedAt,
+			Pending:     len(client.send),
+			Topics:      client.topicList(),
+		})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Pending != clients[j].Pending {
+			return clients[i].Pending > clients[j].Pending
+		}
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+
+	h.metrics.rejectionsMu.Lock()
+	rejected := make(map[string]uint64, len(h.metrics.rejections))
+	for reason, count := range h.metrics.rejections {
+		rejected[reason] = count
+	}
+	h.metrics.rejectionsMu.Unlock()
+
+	h.public.mu.Lock()
+	publicClients, publicDropped := len(h.public.subscribers), h.public.dropped
+	h.public.mu.Unlock()
+
+	return HubMetrics{
+		InstanceID:              instanceID,
+		ConnectedClients:        len(clients),
+		TotalConnections:        h.metrics.connections.Load(),
+		MessagesSent:            h.metrics.messagesSent.Load(),
+		MessagesDropped:         h.metrics.messagesDropped.Load(),
+		SlowClientsDisconnected: h.metrics.slowClients.Load(),
+		WriteErrors:             h.metrics.writeErrors.Load(),
+		QueueChanges:            h.metrics.queueChanges.Load(),
+		StatsBroadcasts:         h.metrics.statsBroadcasts.Load(),
+		ClusterPublished:        h.metrics.clusterPublished.Load(),
+		ClusterReceived:         h.metrics.clusterReceived.Load(),
+		SendBufferSize:          sendBufferSize,
+		PublicStreamClients:     publicClients,
+		PublicStreamDropped:     publicDropped,
+		RejectedConnections:     rejected,
+		Clients:                 clients,
+	}
+}
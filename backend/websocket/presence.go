@@ -0,0 +1,192 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fifo-system/backend/initializers"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A lista de utilizadores online ("online_users" e GET /api/management/presence) tem uma
+// entrada por utilizador, com os seus dispositivos (uma OnlineSession por ligação). O cliente
+// indica a página ou o posto em que está com:
+//
+//	{"type": "presence", "page": "/management", "station": "RTS-01"}
+//
+// A última ação é a hora da última entrada, saída, movimentação ou leitura do utilizador.
+// Como numa rajada de leituras mudaria a cada segundo, a lista não é reenviada a cada ação:
+// é reenviada no heartbeat seguinte (presenceHeartbeat) se tiver havido alguma ação.
+
+// maxPresenceField é o tamanho máximo guardado de cada campo indicado pelo cliente.
+const maxPresenceField = 100
+
+// OnlineDevice é uma ligação de um utilizador.
+type OnlineDevice struct {
+	SessionID   uint      `json:"sessionId"`
+	InstanceID  string    `json:"instanceId"`
+	UserAgent   string    `json:"userAgent"`
+	IP          string    `json:"ip"`
+	Page        string    `json:"page"`
+	Station     string    `json:"station"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// OnlineUser é um utilizador com pelo menos uma ligação ativa. Page e Station são os do
+// dispositivo que mudou de página mais recentemente; ConnectedAt é o da ligação mais antiga.
+type OnlineUser struct {
+	ID           uint           `json:"id"`
+	Username     string         `json:"username"`
+	FullName     string         `json:"fullName"`
+	Role         string         `json:"role"`
+	Sector       string         `json:"sector"`
+	ConnectedAt  time.Time      `json:"connectedAt"`
+	LastActionAt *time.Time     `json:"lastActionAt"`
+	Page         string         `json:"page"`
+	Station      string         `json:"station"`
+	Devices      []OnlineDevice `json:"devices"`
+}
+
+// presenceMessage é o corpo da mensagem "presence".
+type presenceMessage struct {
+	Page    string `json:"page"`
+	Station string `json:"station"`
+}
+
+func init() {
+	inboundHandlers["presence"] = func(h *Hub, c *Client, message inboundMessage) { h.updatePresence(c, message) }
+}
+
+// aggregateSessions agrupa as sessões por utilizador, pela ordem da primeira ligação.
+func aggregateSessions(sessions []models.OnlineSession) []OnlineUser {
+	var users []OnlineUser
+	index := make(map[uint]int)
+	pageChangedAt := make(map[uint]time.Time)
+	for _, session := range sessions {
+		i, ok := index[session.UserID]
+		if !ok {
+			i = len(users)
+			index[session.UserID] = i
+			users = append(users, OnlineUser{
+				ID:          session.UserID,
+				Username:    session.Username,
+				FullName:    session.FullName,
+				Role:        session.Role,
+				Sector:      session.Sector,
+				ConnectedAt: session.ConnectedAt,
+			})
+		}
+		user := &users[i]
+		user.Devices = append(user.Devices, OnlineDevice{
+			SessionID:   session.ID,
+			InstanceID:  session.InstanceID,
+			UserAgent:   session.UserAgent,
+			IP:          session.IP,
+			Page:        session.Page,
+			Station:     session.Station,
+			ConnectedAt: session.ConnectedAt,
+		})
+		if session.ConnectedAt.Before(user.ConnectedAt) {
+			user.ConnectedAt = session.ConnectedAt
+		}
+		if session.LastActionAt != nil && (user.LastActionAt == nil || session.LastActionAt.After(*user.LastActionAt)) {
+			user.LastActionAt = session.LastActionAt
+		}
+		if session.PageChangedAt != nil && session.PageChangedAt.After(pageChangedAt[session.UserID]) {
+			pageChangedAt[session.UserID] = *session.PageChangedAt
+			user.Page, user.Station = session.Page, session.Station
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool { return users[i].ConnectedAt.Before(users[j].ConnectedAt) })
+	return users
+}
+
+// OnlineUsers lê as sessões de todas as instâncias e devolve-as agrupadas por utilizador.
+func (h *Hub) OnlineUsers() ([]OnlineUser, error) {
+	var sessions []models.OnlineSession
+	err := initializers.DB.Where("last_seen_at >= ?", services.GetBrasiliaTime().Add(-presenceTTL)).Order("connected_at asc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return aggregateSessions(sessions), nil
+}
+
+// localSessions descreve as ligações desta instância como OnlineSession, para quando a tabela
+// não pode ser lida. Deve ser chamado com h.mu bloqueado.
+func (h *Hub) localSessions() []models.OnlineSession {
+	sessions := make([]models.OnlineSession, 0, len(h.clients))
+	for client := range h.clients {
+		sessions = append(sessions, models.OnlineSession{
+			ID:            client.sessionID,
+			InstanceID:    instanceID,
+			UserID:        client.UserID,
+			Username:      client.Username,
+			FullName:      client.FullName,
+			Role:          client.Role,
+			Sector:        client.Sector,
+			UserAgent:     client.UserAgent,
+			IP:            client.IP,
+			ConnectedAt:   client.ConnectedAt,
+			Page:          client.page,
+			Station:       client.station,
+			PageChangedAt: client.pageChangedAt,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt) })
+	return sessions
+}
+
+func truncatePresenceField(value string) string {
+	value = strings.TrimSpace(value)
+	if len([]rune(value)) > maxPresenceField {
+		value = string([]rune(value)[:maxPresenceField])
+	}
+	return value
+}
+
+// updatePresence guarda a página ou o posto indicados pelo cliente e atualiza a lista em todas as instâncias.
+func (h *Hub) updatePresence(c *Client, inbound inboundMessage) {
+	var message presenceMessage
+	if err := json.Unmarshal(inbound.raw, &message); err != nil {
+		h.sendTo(c, ErrorMessage{Type: "error", RequestID: inbound.RequestID, Error: "Mensagem de presença inválida."})
+		return
+	}
+	page, station := truncatePresenceField(message.Page), truncatePresenceField(message.Station)
+	now := services.GetBrasiliaTime()
+
+	h.mu.Lock()
+	if c.page == page && c.station == station {
+		h.mu.Unlock()
+		return
+	}
+	c.page, c.station, c.pageChangedAt = page, station, &now
+	sessionID := c.sessionID
+	h.mu.Unlock()
+
+	// Se a sessão ainda não foi gravada, openSession grava a página atual do cliente
+	if sessionID != 0 {
+		err := initializers.DB.Model(&models.OnlineSession{}).Where("id = ?", sessionID).
+			Updates(map[string]interface{}{"page": page, "station": station, "page_changed_at": now}).Error
+		if err != nil {
+			log.Printf("Erro ao atualizar presença de %s: %v", c.Username, err)
+		}
+	}
+	h.publish(clusterPresence, nil)
+	h.broadcastOnlineUsers()
+}
+
+// recordActivity regista a hora da última ação do utilizador em todas as suas sessões.
+// A lista de utilizadores online é reenviada no heartbeat seguinte.
+func (h *Hub) recordActivity(userID uint, at time.Time) {
+	result := initializers.DB.Model(&models.OnlineSession{}).Where("user_id = ?", userID).Update("last_action_at", at)
+	if result.Error != nil {
+		log.Printf("Erro ao registar atividade do utilizador %d: %v", userID, result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		h.presenceDirty.Store(true)
+	}
+}
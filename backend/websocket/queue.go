@@ -0,0 +1,288 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"log"
+	"time"
+)
+
+// O estado da fila chega aos clientes num fluxo sequenciado: um "queue_snapshot" completo
+// na ligação (ou quando o cliente pede "resync") e depois apenas deltas
+// ("package_added", "package_removed", "package_moved" e, agrupado, "stats_changed").
+// Cada mensagem do fluxo leva Seq; se o cliente receber um Seq diferente de último+1,
+// perdeu mensagens e deve pedir um novo snapshot com {"type": "resync"}.
+// Os deltas são idempotentes, por isso um delta já incluído no snapshot pode ser reaplicado.
+// A sequência é de cada cliente e inclui apenas as mensagens dos tópicos da fila que
+// subscreveu (ver topics.go), por isso um filtro por buffer ou rua não abre falhas.
+
+// QueueStats são as estatísticas por buffer, comuns a "queue_snapshot" e "stats_changed".
+type QueueStats struct {
+	BacklogCount   int64                          `json:"backlogCount"`   // Contagem de itens
+	BacklogValue   int64                          `json:"backlogValue"`   // Soma dos valores (P=250, M=80, G=10)
+	BufferCounts   map[string]int64               `json:"bufferCounts"`   // Contagem por buffer
+	BufferValues   map[string]int64               `json:"bufferValues"`   // Soma de valores por buffer
+	BufferAvgTimes map[string]float64             `json:"bufferAvgTimes"` // Tempo médio (só RTS e EHA)
+	BufferDwell    map[string]services.DwellStats `json:"bufferDwell"`    // Percentis e gaiola mais antiga (só RTS e EHA)
+}
+
+// QueueSnapshotMessage é a mensagem "queue_snapshot": a fila completa no instante Seq.
+type QueueSnapshotMessage struct {
+	Type  string           `json:"type"`
+	Seq   uint64           `json:"seq"`
+	Queue []models.Package `json:"queue"`
+	QueueStats
+}
+
+// PackageDeltaMessage é uma alteração de uma gaiola: "package_added" (com Package),
+// "package_removed" ou "package_moved" (com FromRua e Rua). Buffer e Rua servem para
+// encaminhar o delta apenas aos clientes subscritos.
+type PackageDeltaMessage struct {
+	Type       string          `json:"type"`
+	Seq        uint64          `json:"seq"`
+	PackageID  uint            `json:"packageId"`
+	TrackingID string          `json:"trackingId"`
+	Buffer     string          `json:"buffer,omitempty"`
+	Package    *models.Package `json:"package,omitempty"`
+	FromRua    string          `json:"fromRua,omitempty"`
+	Rua        string          `json:"rua,omitempty"`
+}
+
+// StatsChangedMessage é a mensagem "stats_changed", enviada depois de uma ou mais alterações da fila.
+type StatsChangedMessage struct {
+	Type string `json:"type"`
+	Seq  uint64 `json:"seq"`
+	QueueStats
+}
+
+func newQueueStats(state services.QueueState) QueueStats {
+	return QueueStats{
+		BacklogCount:   state.BacklogCount,
+		BacklogValue:   state.BacklogValue,
+		BufferCounts:   state.BufferCounts,
+		BufferValues:   state.BufferValues,
+		BufferAvgTimes: state.BufferAvgTimes,
+		BufferDwell:    state.BufferDwell,
+	}
+}
+
+// queueHistorySize é o número de deltas guardados para reenviar depois de um snapshot.
+const queueHistorySize = 512
+
+type queueHistoryEntry struct {
+	seq   uint64
+	delta PackageDeltaMessage
+}
+
+// queueDeltasAfter devolve os deltas posteriores a since, se ainda estiverem todos no histórico.
+// Deve ser chamado com h.seqMu bloqueado.
+func (h *Hub) queueDeltasAfter(since uint64) ([]PackageDeltaMessage, bool) {
+	if len(h.queueHistory) > 0 && h.queueHistory[0].seq > since+1 {
+		return nil, false
+	}
+	var missed []PackageDeltaMessage
+	for _, entry := range h.queueHistory {
+		if entry.seq > since {
+			missed = append(missed, entry.delta)
+		}
+	}
+	return missed, true
+}
+
+// sendQueueSnapshot envia a um cliente as gaiolas dos tópicos que subscreveu
+// (na ligação, num pedido de "resync" ou quando muda de tópicos).
+// Como no fluxo público, a consulta é feita sem bloquear os deltas: guarda-se o seq do hub
+// antes da consulta e reenviam-se a seguir ao snapshot os deltas publicados entretanto.
+// Se a consulta falhar não é enviado nada; o cliente volta a pedir "resync".
+func (h *Hub) sendQueueSnapshot(client *Client) {
+	for attempt := 0; attempt < 3; attempt++ {
+		h.seqMu.Lock()
+		since := h.queueSeq
+		h.seqMu.Unlock()
+
+		state, err := services.GetCurrentQueueState()
+		if err != nil {
+			log.Printf("Erro ao buscar estado da fila no DB: %v", err)
+			return
+		}
+
+		h.seqMu.Lock()
+		missed, complete := h.queueDeltasAfter(since)
+		if !complete {
+			// Foram publicados mais deltas do que o histórico guarda durante a consulta: repete-a
+			h.seqMu.Unlock()
+			continue
+		}
+		h.mu.Lock()
+		h.writeQueueSnapshot(client, state, missed)
+		h.mu.Unlock()
+		h.seqMu.Unlock()
+
+		if len(missed) > 0 {
+			// Um "stats_changed" enviado durante a consulta pode ser mais recente do que as
+			// estatísticas do snapshot: agenda um novo
+			h.markStatsDirty()
+		}
+		return
+	}
+	log.Printf("Snapshot da fila não enviado a %s: a fila mudou demasiado durante a consulta", client.Username)
+}
+
+// writeQueueSnapshot coloca na fila de envio do cliente o snapshot e, a seguir, os deltas
+// publicados durante a consulta. Deve ser chamado com h.seqMu e h.mu bloqueados.
+func (h *Hub) writeQueueSnapshot(client *Client, state services.QueueState, missed []PackageDeltaMessage) {
+	if !client.wantsQueue() {
+		return
+	}
+	queue := make([]models.Package, 0, len(state.Packages))
+	for _, pkg := range state.Packages {
+		if client.wantsPackage(pkg.Buffer, pkg.Rua) {
+			queue = append(queue, pkg)
+		}
+	}
+	message, err := json.Marshal(QueueSnapshotMessage{
+		Type:       "queue_snapshot",
+		Seq:        client.seq,
+		Queue:      queue,
+		QueueStats: newQueueStats(state),
+	})
+	if err != nil {
+		log.Printf("Erro ao serializar snapshot da fila: %v", err)
+		return
+	}
+	if !h.enqueue(client, message) {
+		return
+	}
+	for _, delta := range missed {
+		if !h.sendQueueDelta(client, delta) {
+			return
+		}
+	}
+}
+
+// sendQueueDelta envia um delta ao cliente com o Seq seguinte, se lhe interessar, e devolve
+// false se o cliente foi desligado. Deve ser chamado com h.seqMu e h.mu bloqueados.
+func (h *Hub) sendQueueDelta(client *Client, delta PackageDeltaMessage) bool {
+	message := client.deltaFor(delta)
+	if message == nil {
+		return true
+	}
+	message.Seq = client.seq + 1
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Erro ao serializar delta da fila: %v", err)
+		return true
+	}
+	if !h.enqueue(client, data) {
+		return false
+	}
+	client.seq++
+	return true
+}
+
+// deltaFor adapta o delta aos tópicos do cliente, ou devolve nil se não lhe interessar.
+// Uma movimentação entre uma rua subscrita e outra que não o é chega ao cliente como
+// "package_added" ou "package_removed". Deve ser chamado com h.mu bloqueado.
+func (c *Client) deltaFor(delta PackageDeltaMessage) *PackageDeltaMessage {
+	if delta.Type != "package_moved" {
+		if !c.wantsPackage(delta.Buffer, delta.Rua) {
+			return nil
+		}
+		return &delta
+	}
+
+	before := c.wantsPackage(delta.Buffer, delta.FromRua)
+	after := c.wantsPackage(delta.Buffer, delta.Rua)
+	switch {
+	case before && after:
+		return &delta
+	case after:
+		return &PackageDeltaMessage{Type: "package_added", PackageID: delta.PackageID, TrackingID: delta.TrackingID, Buffer: delta.Buffer, Rua: delta.Rua, Package: delta.Package}
+	case before:
+		return &PackageDeltaMessage{Type: "package_removed", PackageID: delta.PackageID, TrackingID: delta.TrackingID, Buffer: delta.Buffer, Rua: delta.FromRua}
+	}
+	return nil
+}
+
+// broadcastQueueDelta envia o delta aos clientes interessados, cada um com o seu Seq.
+// As estatísticas não são recalculadas a cada delta: ficam marcadas como desatualizadas
+// e são enviadas por flushQueueStats, no máximo uma vez por statsBroadcastWindow.
+func (h *Hub) broadcastQueueDelta(delta PackageDeltaMessage) {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+
+	h.queueSeq++
+	h.queueHistory = append(h.queueHistory, queueHistoryEntry{seq: h.queueSeq, delta: delta})
+	if len(h.queueHistory) > queueHistorySize {
+		h.queueHistory = h.queueHistory[len(h.queueHistory)-queueHistorySize:]
+	}
+
+	h.mu.Lock()
+	for client := range h.clients {
+		h.sendQueueDelta(client, delta)
+	}
+	h.mu.Unlock()
+	h.publishPublic(delta.Type, publicQueueDelta(delta))
+
+	h.metrics.queueChanges.Add(1)
+	h.markStatsDirty()
+}
+
+// statsBroadcastWindow é o intervalo mínimo entre dois "stats_changed". Numa rajada de
+// leituras as alterações da janela são agrupadas num único cálculo das estatísticas.
+const statsBroadcastWindow = 250 * time.Millisecond
+
+// markStatsDirty regista que as estatísticas mudaram e agenda o envio, se ainda não houver um agendado.
+func (h *Hub) markStatsDirty() {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+	h.statsDirty = true
+	if !h.statsScheduled {
+		h.statsScheduled = true
+		time.AfterFunc(statsBroadcastWindow, h.flushQueueStats)
+	}
+}
+
+// flushQueueStats calcula as estatísticas uma vez e envia "stats_changed" a todos os clientes.
+// Se houver alterações durante o cálculo, agenda novo envio para a janela seguinte, o que
+// garante que a última alteração de uma rajada é sempre seguida de estatísticas atualizadas.
+func (h *Hub) flushQueueStats() {
+	h.statsMu.Lock()
+	h.statsDirty = false
+	h.statsMu.Unlock()
+
+	state, err := services.GetQueueStats()
+	if err != nil {
+		log.Printf("Erro ao calcular estatísticas da fila: %v", err)
+	} else {
+		stats := newQueueStats(state)
+		h.seqMu.Lock()
+		h.mu.Lock()
+		for client := range h.clients {
+			if !client.wantsQueue() {
+				continue
+			}
+			message, err := json.Marshal(StatsChangedMessage{Type: "stats_changed", Seq: client.seq + 1, QueueStats: stats})
+			if err != nil {
+				log.Printf("Erro ao serializar estatísticas da fila: %v", err)
+				break
+			}
+			if h.enqueue(client, message) {
+				client.seq++
+			}
+		}
+		h.mu.Unlock()
+		h.publishPublic("stats", stats)
+		h.seqMu.Unlock()
+		h.metrics.statsBroadcasts.Add(1)
+	}
+
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+	if h.statsDirty {
+		time.AfterFunc(statsBroadcastWindow, h.flushQueueStats)
+	} else {
+		h.statsScheduled = false
+	}
+}
@@ -0,0 +1,328 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fifo-system/backend/config"
+	"fifo-system/backend/models"
+	"fifo-system/backend/services"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// O fluxo público (GET /public/stream) leva aos ecrãs em modo convidado as mesmas alterações
+// da fila que o hub envia pelo WebSocket, como Server-Sent Events e com menos campos por gaiola:
+//
+//	event: snapshot         a fila completa e as estatísticas
+//	event: package_added    {packageId, trackingId, package}
+//	event: package_removed  {packageId, trackingId}
+//	event: package_moved    {packageId, trackingId, fromRua, rua}
+//	event: stats            as estatísticas por buffer (agrupadas como "stats_changed")
+//
+// Cada IP pode abrir até PUBLIC_STREAM_RATE_LIMIT ligações por minuto (como no WebSocket).
+// Cada evento tem um id "<instância>:<seq>". Ao voltar a ligar, o EventSource envia o último
+// id em Last-Event-ID: se for desta instância e ainda estiver no histórico, recebe apenas os
+// eventos em falta; caso contrário recebe um snapshot novo.
+
+const (
+	publicHistorySize  = 512 // Eventos guardados para retomar ligações
+	publicBufferSize   = 64  // Eventos à espera de envio por ligação
+	publicHeartbeat    = 25 * time.Second
+	publicRetryMillis  = 3000
+	publicWriteTimeout = 10 * time.Second
+)
+
+// PublicPackage é a gaiola tal como aparece no fluxo público (mesmos nomes de campos que models.Package).
+type PublicPackage struct {
+	ID             uint
+	TrackingID     string
+	Buffer         string
+	Rua            string
+	Profile        string
+	EntryTimestamp time.Time
+}
+
+// PublicSnapshot é o evento "snapshot".
+type PublicSnapshot struct {
+	Queue []PublicPackage `json:"queue"`
+	QueueStats
+}
+
+// PublicDelta é o corpo dos eventos "package_added", "package_removed" e "package_moved".
+type PublicDelta struct {
+	PackageID  uint           `json:"packageId"`
+	TrackingID string         `json:"trackingId"`
+	Package    *PublicPackage `json:"package,omitempty"`
+	FromRua    string         `json:"fromRua,omitempty"`
+	Rua        string         `json:"rua,omitempty"`
+}
+
+type publicEvent struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+type publicSubscriber struct {
+	events chan publicEvent
+}
+
+// publicStream guarda o histórico recente de eventos e as ligações ativas.
+type publicStream struct {
+	mu          sync.Mutex
+	seq         uint64
+	history     []publicEvent
+	subscribers map[*publicSubscriber]bool
+	dropped     uint64 // Ligações desligadas por não acompanharem
+}
+
+func newPublicPackage(pkg models.Package) PublicPackage {
+	return PublicPackage{
+		ID:             pkg.ID,
+		TrackingID:     pkg.TrackingID,
+		Buffer:         pkg.Buffer,
+		Rua:            pkg.Rua,
+		Profile:        pkg.Profile,
+		EntryTimestamp: pkg.EntryTimestamp,
+	}
+}
+
+// publishPublic acrescenta um evento ao fluxo público e entrega-o às ligações.
+// É chamado com h.seqMu bloqueado, pela mesma ordem das mensagens do WebSocket.
+func (h *Hub) publishPublic(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Erro ao serializar evento público %s: %v", name, err)
+		return
+	}
+
+	s := &h.public
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	event := publicEvent{id: s.seq, name: name, data: data}
+	s.history = append(s.history, event)
+	if len(s.history) > publicHistorySize {
+		s.history = s.history[len(s.history)-publicHistorySize:]
+	}
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber.events <- event:
+		default:
+			// A ligação não acompanha: é fechada e o EventSource volta a ligar e retoma pelo histórico
+			delete(s.subscribers, subscriber)
+			close(subscriber.events)
+			s.dropped++
+		}
+	}
+}
+
+// publicQueueDelta converte um delta do WebSocket no evento público correspondente.
+func publicQueueDelta(delta PackageDeltaMessage) PublicDelta {
+	public := PublicDelta{PackageID: delta.PackageID, TrackingID: delta.TrackingID}
+	switch delta.Type {
+	case "package_added":
+		if delta.Package != nil {
+			pkg := newPublicPackage(*delta.Package)
+			public.Package = &pkg
+		}
+	case "package_moved":
+		public.FromRua, public.Rua = delta.FromRua, delta.Rua
+	}
+	return public
+}
+
+// parsePublicEventID devolve o seq de um id "<instância>:<seq>" desta instância.
+func parsePublicEventID(id string) (uint64, bool) {
+	instance, seq, found := strings.Cut(id, ":")
+	if !found || instance != instanceID {
+		return 0, false
+	}
+	parsed, err := strconv.ParseUint(seq, 10, 64)
+	return parsed, err == nil
+}
+
+func formatPublicEventID(seq uint64) string {
+	return fmt.Sprintf("%s:%d", instanceID, seq)
+}
+
+var errPublicStreamFull = errors.New("limite de ligações ao fluxo público atingido")
+
+// add regista uma ligação, se o limite de ligações o permitir. Deve ser chamado com s.mu bloqueado.
+func (s *publicStream) add(subscriber *publicSubscriber) error {
+	if len(s.subscribers) >= config.AppConfig.PublicStreamMaxConnections {
+		return errPublicStreamFull
+	}
+	s.subscribers[subscriber] = true
+	return nil
+}
+
+// eventsAfter devolve os eventos posteriores a lastSeq, se ainda estiverem todos no histórico.
+// Deve ser chamado com s.mu bloqueado.
+func (s *publicStream) eventsAfter(lastSeq uint64) ([]publicEvent, bool) {
+	if lastSeq > s.seq || (len(s.history) > 0 && s.history[0].id > lastSeq+1) {
+		return nil, false
+	}
+	var missed []publicEvent
+	for _, event := range s.history {
+		if event.id > lastSeq {
+			missed = append(missed, event)
+		}
+	}
+	return missed, true
+}
+
+// subscribePublic regista uma ligação ao fluxo público e devolve os eventos a enviar primeiro:
+// os eventos em falta, se lastEventID permitir retomar, ou um snapshot da fila.
+func (h *Hub) subscribePublic(lastEventID string) (*publicSubscriber, []publicEvent, error) {
+	s := &h.public
+	subscriber := &publicSubscriber{events: make(chan publicEvent, publicBufferSize)}
+
+	if lastSeq, ok := parsePublicEventID(lastEventID); ok {
+		s.mu.Lock()
+		missed, resumed := s.eventsAfter(lastSeq)
+		if resumed {
+			err := s.add(subscriber)
+			s.mu.Unlock()
+			return subscriber, missed, err
+		}
+		s.mu.Unlock()
+	}
+
+	// O snapshot é montado sem bloquear a publicação dos deltas: guarda-se o seq antes da
+	// consulta e enviam-se a seguir ao snapshot os eventos publicados entretanto. Alguns podem
+	// já estar refletidos no snapshot, o que não é problema porque os deltas são idempotentes.
+	for attempt := 0; attempt < 3; attempt++ {
+		s.mu.Lock()
+		full := len(s.subscribers) >= config.AppConfig.PublicStreamMaxConnections
+		since := s.seq
+		s.mu.Unlock()
+		if full {
+			return nil, nil, errPublicStreamFull // Evita a consulta da fila quando a ligação seria recusada
+		}
+
+		data, err := publicSnapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		s.mu.Lock()
+		missed, complete := s.eventsAfter(since)
+		if complete {
+			err := s.add(subscriber)
+			s.mu.Unlock()
+			if err != nil {
+				return nil, nil, err
+			}
+			return subscriber, append([]publicEvent{{id: since, name: "snapshot", data: data}}, missed...), nil
+		}
+		s.mu.Unlock()
+		// Foram publicados mais eventos do que o histórico guarda durante a consulta: repete-a
+	}
+	return nil, nil, errors.New("a fila mudou demasiado durante a montagem do snapshot")
+}
+
+// publicSnapshot monta o evento "snapshot" com a fila e as estatísticas atuais. Se a fila não
+// puder ser lida devolve o erro, e ServeStream responde 500 para que o EventSource volte a ligar.
+func publicSnapshot() ([]byte, error) {
+	state, err := services.GetCurrentQueueState()
+	if err != nil {
+		return nil, fmt.Errorf("falha ao buscar estado da fila: %w", err)
+	}
+	queue := make([]PublicPackage, 0, len(state.Packages))
+	for _, pkg := range state.Packages {
+		queue = append(queue, newPublicPackage(pkg))
+	}
+	return json.Marshal(PublicSnapshot{Queue: queue, QueueStats: newQueueStats(state)})
+}
+
+func (h *Hub) unsubscribePublic(subscriber *publicSubscriber) {
+	s := &h.public
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscribers[subscriber]; ok {
+		delete(s.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// ServeStream é o handler de GET /public/stream.
+func ServeStream(c *gin.Context) {
+	ip := c.ClientIP()
+	if !H.streamLimiter.allow(ip, config.AppConfig.PublicStreamRateLimit, time.Now()) {
+		slog.Warn("Ligação ao fluxo público recusada", "reason", rejectRateLimit, "ip", ip)
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Demasiados pedidos de ligação. Tente novamente dentro de um minuto."})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	subscriber, initial, err := H.subscribePublic(lastEventID)
+	if errors.Is(err, errPublicStreamFull) {
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Limite de ligações ao fluxo público atingido. Tente novamente mais tarde."})
+		return
+	}
+	if err != nil {
+		log.Printf("Erro ao abrir fluxo público: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao abrir o fluxo público."})
+		return
+	}
+	defer H.unsubscribePublic(subscriber)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	controller := http.NewResponseController(c.Writer)
+	write := func(chunk string) bool {
+		controller.SetWriteDeadline(time.Now().Add(publicWriteTimeout))
+		if _, err := c.Writer.WriteString(chunk); err != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+	writeEvent := func(event publicEvent) bool {
+		return write(fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", formatPublicEventID(event.id), event.name, event.data))
+	}
+
+	if !write(fmt.Sprintf("retry: %d\n\n", publicRetryMillis)) {
+		return
+	}
+	for _, event := range initial {
+		if !writeEvent(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(publicHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-subscriber.events:
+			if !ok || !writeEvent(event) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
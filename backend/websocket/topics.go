@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Cada cliente escolhe os tópicos que quer receber com {"type": "subscribe", "topics": [...]}
+// e {"type": "unsubscribe", "topics": [...]}. Uma ligação nova fica subscrita a defaultTopics,
+// o que mantém o comportamento anterior (recebe tudo).
+//
+//	queue          todas as gaiolas da fila
+//	buffer:<RTS>   apenas as gaiolas de um buffer (RTS, EHA ou SAL)
+//	rua:<R01>      apenas as gaiolas de uma rua
+//	alerts         alertas de SLA e regras de alerta
+//	presence       lista de utilizadores online (apenas administradores e líderes)
+//	announcements  avisos enviados pelos líderes
+//
+// Os tópicos da fila (queue, buffer:, rua:) definem o conteúdo do "queue_snapshot" e dos
+// deltas que o cliente recebe; "stats_changed" é enviado a quem tiver algum tópico da fila.
+const (
+	TopicQueue         = "queue"
+	TopicAlerts        = "alerts"
+	TopicPresence      = "presence"
+	TopicAnnouncements = "announcements"
+
+	topicBufferPrefix = "buffer:"
+	topicRuaPrefix    = "rua:"
+)
+
+var defaultTopics = []string{TopicQueue, TopicAlerts, TopicPresence, TopicAnnouncements}
+
+var topicBuffers = map[string]bool{"RTS": true, "EHA": true, "SAL": true}
+
+// normalizeTopic valida um tópico e devolve-o na forma canónica (ex: "buffer:eha" -> "buffer:EHA").
+func normalizeTopic(topic string) (string, error) {
+	topic = strings.TrimSpace(topic)
+	lower := strings.ToLower(topic)
+	switch {
+	case lower == TopicQueue, lower == TopicAlerts, lower == TopicPresence, lower == TopicAnnouncements:
+		return lower, nil
+	case strings.HasPrefix(lower, topicBufferPrefix):
+		buffer := strings.ToUpper(strings.TrimSpace(topic[len(topicBufferPrefix):]))
+		if !topicBuffers[buffer] {
+			return "", fmt.Errorf("buffer inválido no tópico %q. Use RTS, EHA ou SAL", topic)
+		}
+		return topicBufferPrefix + buffer, nil
+	case strings.HasPrefix(lower, topicRuaPrefix):
+		rua := strings.ToUpper(strings.TrimSpace(topic[len(topicRuaPrefix):]))
+		if rua == "" {
+			return "", fmt.Errorf("rua em falta no tópico %q", topic)
+		}
+		return topicRuaPrefix + rua, nil
+	}
+	return "", fmt.Errorf("tópico desconhecido: %q", topic)
+}
+
+func isQueueTopic(topic string) bool {
+	return topic == TopicQueue || strings.HasPrefix(topic, topicBufferPrefix) || strings.HasPrefix(topic, topicRuaPrefix)
+}
+
+// subscribed indica se o cliente subscreveu o tópico. Deve ser chamado com h.mu bloqueado.
+func (c *Client) subscribed(topic string) bool {
+	return c.topics[topic]
+}
+
+// wantsQueue indica se o cliente tem algum tópico da fila. Deve ser chamado com h.mu bloqueado.
+func (c *Client) wantsQueue() bool {
+	for topic := range c.topics {
+		if isQueueTopic(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsPackage indica se uma gaiola no buffer e rua indicados interessa ao cliente.
+// Os tópicos estão em maiúsculas, por isso a rua é comparada sem distinguir maiúsculas.
+// Deve ser chamado com h.mu bloqueado.
+func (c *Client) wantsPackage(buffer, rua string) bool {
+	return c.topics[TopicQueue] || c.topics[topicBufferPrefix+buffer] || c.topics[topicRuaPrefix+strings.ToUpper(strings.TrimSpace(rua))]
+}
+
+// topicList devolve os tópicos do cliente por ordem alfabética. Deve ser chamado com h.mu bloqueado.
+func (c *Client) topicList() []string {
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// inboundMessage é uma mensagem enviada pelo cliente.
+type inboundMessage struct {
+	Type      string   `json:"type"`
+	RequestID string   `json:"requestId,omitempty"`
+	Topics    []string `json:"topics,omitempty"`
+
+	raw []byte // Mensagem completa, para os tratamentos que leem outros campos (ver commands.go)
+}
+
+// inboundSizeLimits é o tamanho máximo, em bytes, de cada tipo de mensagem recebida;
+// os tipos que não constam estão limitados a maxMessageSize. A ligação aceita mensagens
+// até maxInboundSize e o limite do tipo é verificado depois de conhecido o tipo.
+var inboundSizeLimits = map[string]int{
+	"subscribe":   2048,
+	"unsubscribe": 2048,
+	"entry":       1024,
+	"exit":        1024,
+	"move":        1024,
+	"scan":        1024,
+}
+
+// SubscriptionsMessage é a resposta a "subscribe" e "unsubscribe", com os tópicos atuais.
+type SubscriptionsMessage struct {
+	Type   string   `json:"type"`
+	Topics []string `json:"topics"`
+}
+
+// ErrorMessage é enviada ao cliente quando uma mensagem recebida é rejeitada.
+type ErrorMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"requestId,omitempty"`
+	Error     string `json:"error"`
+}
+
+type inboundHandler func(h *Hub, c *Client, message inboundMessage)
+
+// inboundHandlers associa cada tipo de mensagem recebida ao seu tratamento.
+var inboundHandlers = map[string]inboundHandler{
+	// O cliente detetou uma falha na sequência e pede a fila completa.
+	"resync": func(h *Hub, c *Client, _ inboundMessage) { h.sendQueueSnapshot(c) },
+	"subscribe": func(h *Hub, c *Client, message inboundMessage) {
+		h.updateSubscriptions(c, message.Topics, true)
+	},
+	"unsubscribe": func(h *Hub, c *Client, message inboundMessage) {
+		h.updateSubscriptions(c, message.Topics, false)
+	},
+}
+
+// handleInbound encaminha uma mensagem recebida do cliente para o seu tratamento.
+func (h *Hub) handleInbound(c *Client, data []byte) {
+	var message inboundMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		h.sendTo(c, ErrorMessage{Type: "error", Error: "Mensagem inválida: JSON esperado."})
+		return
+	}
+	message.raw = data
+	if len(message.RequestID) > maxRequestIDLength {
+		message.RequestID = "" // Não é devolvido nas respostas de erro
+	}
+	handler, ok := inboundHandlers[message.Type]
+	if !ok {
+		h.sendTo(c, ErrorMessage{Type: "error", RequestID: message.RequestID, Error: fmt.Sprintf("Tipo de mensagem desconhecido: %q.", message.Type)})
+		return
+	}
+	limit, ok := inboundSizeLimits[message.Type]
+	if !ok {
+		limit = maxMessageSize
+	}
+	if len(data) > limit {
+		h.sendTo(c, ErrorMessage{Type: "error", RequestID: message.RequestID, Error: fmt.Sprintf("Mensagem %q demasiado grande (máximo %d bytes).", message.Type, limit)})
+		return
+	}
+	handler(h, c, message)
+}
+
+// updateSubscriptions acrescenta ou retira tópicos do cliente e responde com os tópicos atuais.
+// Se os tópicos da fila mudarem, envia um snapshot novo com as gaiolas que passam a interessar.
+func (h *Hub) updateSubscriptions(c *Client, topics []string, subscribe bool) {
+	if len(topics) == 0 {
+		h.sendTo(c, ErrorMessage{Type: "error", Error: "Indique pelo menos um tópico."})
+		return
+	}
+	normalized := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		topic, err := normalizeTopic(topic)
+		if err != nil {
+			h.sendTo(c, ErrorMessage{Type: "error", Error: err.Error()})
+			return
+		}
+		normalized = append(normalized, topic)
+	}
+
+	h.mu.Lock()
+	queueChanged, presenceAdded := false, false
+	for _, topic := range normalized {
+		if c.topics[topic] == subscribe {
+			continue
+		}
+		if subscribe {
+			c.topics[topic] = true
+		} else {
+			delete(c.topics, topic)
+		}
+		queueChanged = queueChanged || isQueueTopic(topic)
+		presenceAdded = presenceAdded || (subscribe && topic == TopicPresence)
+	}
+	current := c.topicList()
+	h.mu.Unlock()
+
+	h.sendTo(c, SubscriptionsMessage{Type: "subscriptions", Topics: current})
+	if queueChanged {
+		h.sendQueueSnapshot(c)
+	}
+	if presenceAdded {
+		h.broadcastOnlineUsers()
+	}
+}
+
+// sendTo envia uma mensagem a um único cliente.
+func (h *Hub) sendTo(c *Client, v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Erro ao serializar mensagem para %s: %v", c.Username, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.enqueue(c, message)
+}
@@ -1,11 +1,19 @@
 // src/context/WebSocketContext.jsx
-import React, { createContext, useState, useEffect, useContext, useCallback, useMemo } from 'react';
+import React, { createContext, useState, useEffect, useContext, useCallback, useMemo, useRef } from 'react';
+import { useLocation } from 'react-router-dom';
 import { useAuth } from './AuthContext';
+import api from '../services/api';
 
 const WebSocketContext = createContext();
 
+// Espera antes de voltar a ligar o WebSocket: duplica a cada falha, de 1s até 30s.
+const RECONNECT_BASE_MS = 1000;
+const RECONNECT_MAX_MS = 30000;
+// Tempo sem snapshot da fila depois do qual um delta recebido leva a pedir "resync".
+const SNAPSHOT_TIMEOUT_MS = 5000;
+
 export const WebSocketProvider = ({ children }) => {
-    const { token, user, isGuest } = useAuth();
+    const { token, user, isGuest, logout } = useAuth();
     const [onlineUsers, setOnlineUsers] = useState([]);
     const [wsQueue, setWsQueue] = useState([]);
     const [wsBacklog, setWsBacklog] = useState(0);
@@ -14,23 +22,77 @@ export const WebSocketProvider = ({ children }) => {
     const [wsBufferValues, setWsBufferValues] = useState({ RTS: 0, EHA: 0, SAL: 0 });
     // --- NOVOS ESTADOS PARA TEMPO MÉDIO ---
     const [wsBufferAvgTimes, setWsBufferAvgTimes] = useState({ RTS: 0.0, EHA: 0.0 });
+    const [wsBufferDwell, setWsBufferDwell] = useState({});
     const [isConnected, setIsConnected] = useState(false);
+    // Número de sequência da última mensagem da fila aplicada (null até chegar o snapshot).
+    const lastSeqRef = useRef(null);
+    // Quando foi pedido o último snapshot (ligação ou resync); se não chegar, é pedido de novo.
+    const snapshotRequestedAtRef = useRef(0);
+    // Ligação atual e página em que o utilizador está, indicada ao servidor na lista de utilizadores online.
+    const wsRef = useRef(null);
+    const location = useLocation();
+    const pageRef = useRef(location.pathname);
+
+    const sendPresence = useCallback(() => {
+        const ws = wsRef.current;
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({ type: 'presence', page: pageRef.current }));
+        }
+    }, []);
+
+    useEffect(() => {
+        pageRef.current = location.pathname;
+        sendPresence();
+    }, [location.pathname, sendPresence]);
 
     useEffect(() => {
         let ws = null;
+        let stream = null;
+        let cancelled = false;
+        let reconnectTimer = null;
+        let reconnectAttempts = 0;
 
-        if (token) {
-            // ... (conexão ws) ...
+        // Aplica as estatísticas comuns a "queue_snapshot", "stats_changed" e aos eventos do fluxo público.
+        const applyStats = (message) => {
+            setWsBacklog(message.backlogCount || 0);
+            setWsBacklogValue(message.backlogValue || 0);
+            setWsBufferCounts(message.bufferCounts || { RTS: 0, EHA: 0, SAL: 0 });
+            setWsBufferValues(message.bufferValues || { RTS: 0, EHA: 0, SAL: 0 });
+            setWsBufferAvgTimes(message.bufferAvgTimes || { RTS: 0.0, EHA: 0.0 });
+            setWsBufferDwell(message.bufferDwell || {});
+        };
+
+        // Abre o WebSocket com um ticket de uso único: o JWT nunca vai no URL.
+        const connect = async () => {
+            const { data } = await api.post('/api/ws/ticket', null, {
+                headers: { Authorization: `Bearer ${token}` },
+            });
+            if (cancelled) {
+                return;
+            }
             const baseURL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
             const wsURL = baseURL.replace(/^http/, 'ws');
-            const finalWsUrl = `${wsURL}/api/ws?token=${token}`;
 
-            console.log("Tentando conectar WebSocket (Autenticado):", finalWsUrl);
-            ws = new WebSocket(finalWsUrl);
+            console.log("Tentando conectar WebSocket (Autenticado)");
+            ws = new WebSocket(`${wsURL}/api/ws?ticket=${encodeURIComponent(data.ticket)}`);
+            wsRef.current = ws;
 
             ws.onopen = () => {
                 console.log("Conexão WebSocket Estabelecida (Autenticado)");
+                reconnectAttempts = 0;
+                snapshotRequestedAtRef.current = Date.now();
                 setIsConnected(true);
+                sendPresence();
+            };
+
+            // Pede a fila completa quando falta alguma mensagem da sequência.
+            const requestResync = (reason) => {
+                console.warn("Sequência da fila interrompida, a pedir resync:", reason);
+                lastSeqRef.current = null;
+                snapshotRequestedAtRef.current = Date.now();
+                if (ws && ws.readyState === WebSocket.OPEN) {
+                    ws.send(JSON.stringify({ type: 'resync' }));
+                }
             };
 
             ws.onmessage = (event) => {
@@ -42,14 +104,53 @@ export const WebSocketProvider = ({ children }) => {
                         if (user && (user.role === 'admin' || user.role === 'leader')) {
                             setOnlineUsers(message.data || []);
                         }
-                    } else if (message.type === 'queue_update') {
+                        return;
+                    }
+
+                    if (message.type === 'session_terminated') {
+                        // Um líder terminou a sessão: o token já foi revogado e a ligação vai ser fechada.
+                        alert(`${message.reason}${message.by ? ` (${message.by})` : ''}`);
+                        logout();
+                        return;
+                    }
+
+                    if (message.type === 'queue_snapshot') {
+                        lastSeqRef.current = message.seq;
                         setWsQueue(message.queue || []);
-                        setWsBacklog(message.backlogCount || 0);
-                        setWsBacklogValue(message.backlogValue || 0);
-                        setWsBufferCounts(message.bufferCounts || { RTS: 0, EHA: 0, SAL: 0 });
-                        setWsBufferValues(message.bufferValues || { RTS: 0, EHA: 0, SAL: 0 });
-                        // --- ARMAZENA TEMPO MÉDIO ---
-                        setWsBufferAvgTimes(message.bufferAvgTimes || { RTS: 0.0, EHA: 0.0 });
+                        applyStats(message);
+                        return;
+                    }
+
+                    const isQueueDelta = ['package_added', 'package_removed', 'package_moved', 'stats_changed'].includes(message.type);
+                    if (!isQueueDelta) {
+                        return;
+                    }
+                    // Deltas recebidos antes do snapshot (ou à espera do resync) são ignorados.
+                    // Se o servidor não conseguiu montar o snapshot não envia nada: volta a pedi-lo.
+                    if (lastSeqRef.current === null) {
+                        if (Date.now() - snapshotRequestedAtRef.current > SNAPSHOT_TIMEOUT_MS) {
+                            requestResync('snapshot da fila não recebido');
+                        }
+                        return;
+                    }
+                    if (message.seq <= lastSeqRef.current) {
+                        return; // Já incluído no snapshot
+                    }
+                    if (message.seq !== lastSeqRef.current + 1) {
+                        requestResync(`esperado ${lastSeqRef.current + 1}, recebido ${message.seq}`);
+                        return;
+                    }
+                    lastSeqRef.current = message.seq;
+
+                    if (message.type === 'package_added') {
+                        // Os deltas são idempotentes: substitui o item se já existir.
+                        setWsQueue(prev => [...prev.filter(item => item.ID !== message.packageId), message.package]);
+                    } else if (message.type === 'package_removed') {
+                        setWsQueue(prev => prev.filter(item => item.ID !== message.packageId));
+                    } else if (message.type === 'package_moved') {
+                        setWsQueue(prev => prev.map(item => (item.ID === message.packageId ? { ...item, Rua: message.rua } : item)));
+                    } else if (message.type === 'stats_changed') {
+                        applyStats(message);
                     }
                 } catch (e) {
                     console.error("Erro ao processar mensagem do WebSocket:", e);
@@ -67,23 +168,87 @@ export const WebSocketProvider = ({ children }) => {
                 setWsBufferValues({ RTS: 0, EHA: 0, SAL: 0 });
                 // --- RESET TEMPO MÉDIO ---
                 setWsBufferAvgTimes({ RTS: 0.0, EHA: 0.0 });
+                setWsBufferDwell({});
+                lastSeqRef.current = null;
+                scheduleReconnect();
             };
             ws.onerror = (error) => {
                 console.error("Erro no WebSocket (Autenticado):", error);
                 setIsConnected(false);
             };
+        };
+
+        // Cada nova tentativa pede um ticket novo, já que o anterior só pode ser usado uma vez.
+        const startConnection = () => {
+            connect().catch((error) => {
+                console.error("Falha ao obter ticket do WebSocket:", error);
+                setIsConnected(false);
+                scheduleReconnect();
+            });
+        };
+
+        // Volta a ligar com backoff exponencial (com alguma aleatoriedade, para que os ecrãs
+        // não voltem todos ao mesmo tempo depois de uma falha do servidor).
+        const scheduleReconnect = () => {
+            if (cancelled || reconnectTimer) {
+                return;
+            }
+            const delay = Math.min(RECONNECT_MAX_MS, RECONNECT_BASE_MS * 2 ** reconnectAttempts);
+            reconnectAttempts += 1;
+            const jittered = delay / 2 + Math.random() * (delay / 2);
+            console.log(`A voltar a ligar o WebSocket dentro de ${Math.round(jittered / 1000)}s...`);
+            reconnectTimer = setTimeout(() => {
+                reconnectTimer = null;
+                startConnection();
+            }, jittered);
+        };
+
+        if (token) {
+            startConnection();
 
         } else if (isGuest) {
-            console.log("Modo Convidado: WebSocket não será conectado.");
+            // O modo convidado não tem token: recebe as atualizações da fila pelo fluxo público (SSE).
+            // O EventSource volta a ligar sozinho e retoma a partir do último evento recebido.
+            const baseURL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
+            console.log("Modo Convidado: a ligar ao fluxo público.");
             setOnlineUsers([]);
-            setWsQueue([]);
-            setWsBacklog(0);
-            setWsBacklogValue(0);
-            setWsBufferCounts({ RTS: 0, EHA: 0, SAL: 0 });
-            setWsBufferValues({ RTS: 0, EHA: 0, SAL: 0 });
-             // --- RESET TEMPO MÉDIO ---
-            setWsBufferAvgTimes({ RTS: 0.0, EHA: 0.0 });
-            setIsConnected(false);
+            stream = new EventSource(`${baseURL}/public/stream`);
+
+            stream.onopen = () => {
+                console.log("Fluxo público ligado (Convidado)");
+                setIsConnected(true);
+            };
+
+            // Cada evento do fluxo público é tratado por um handler com os dados já interpretados.
+            const listen = (name, handler) => {
+                stream.addEventListener(name, (event) => {
+                    try {
+                        handler(JSON.parse(event.data));
+                    } catch (e) {
+                        console.error("Erro ao processar evento do fluxo público:", e);
+                    }
+                });
+            };
+            listen('snapshot', (message) => {
+                setWsQueue(message.queue || []);
+                applyStats(message);
+            });
+            listen('package_added', (message) => {
+                setWsQueue(prev => [...prev.filter(item => item.ID !== message.packageId), message.package]);
+            });
+            listen('package_removed', (message) => {
+                setWsQueue(prev => prev.filter(item => item.ID !== message.packageId));
+            });
+            listen('package_moved', (message) => {
+                setWsQueue(prev => prev.map(item => (item.ID === message.packageId ? { ...item, Rua: message.rua } : item)));
+            });
+            listen('stats', applyStats);
+
+            stream.onerror = () => {
+                // O EventSource tenta voltar a ligar; até lá o painel usa os dados da API.
+                console.warn("Fluxo público interrompido (Convidado)");
+                setIsConnected(false);
+            };
 
         } else {
             setIsConnected(false);
@@ -95,16 +260,25 @@ export const WebSocketProvider = ({ children }) => {
             setWsBufferValues({ RTS: 0, EHA: 0, SAL: 0 });
              // --- RESET TEMPO MÉDIO ---
             setWsBufferAvgTimes({ RTS: 0.0, EHA: 0.0 });
+            setWsBufferDwell({});
         }
 
         return () => {
+            cancelled = true;
+            clearTimeout(reconnectTimer);
+            wsRef.current = null;
             if (ws) {
                 console.log("Fechando conexão WebSocket...");
                 ws.close();
                 setIsConnected(false);
             }
+            if (stream) {
+                console.log("Fechando fluxo público...");
+                stream.close();
+                setIsConnected(false);
+            }
         };
-    }, [token, isGuest, user]);
+    }, [token, isGuest, user, logout, sendPresence]);
 
     const value = useMemo(() => ({
         onlineUsers,
@@ -114,8 +288,9 @@ export const WebSocketProvider = ({ children }) => {
         wsBufferCounts,
         wsBufferValues,
         wsBufferAvgTimes, // <-- EXPOSTO
+        wsBufferDwell,
         isConnected
-    }), [onlineUsers, wsQueue, wsBacklog, wsBacklogValue, wsBufferCounts, wsBufferValues, wsBufferAvgTimes, isConnected]); // <-- ATUALIZADO
+    }), [onlineUsers, wsQueue, wsBacklog, wsBacklogValue, wsBufferCounts, wsBufferValues, wsBufferAvgTimes, wsBufferDwell, isConnected]); // <-- ATUALIZADO
 
     return (
         <WebSocketContext.Provider value={value}>
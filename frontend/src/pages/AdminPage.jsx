@@ -224,6 +224,18 @@ function AdminPage() {
     const openEditModal = (user) => { setSelectedUser(user); setEditModalOpen(true); };
     const openResetModal = (user) => { setSelectedUser(user); setResetModalOpen(true); };
 
+    // Termina a sessão de um utilizador online: revoga os tokens e desliga-o em todos os dispositivos.
+    const handleTerminateSession = async (user) => {
+        const reason = window.prompt(`Terminar a sessão de ${user.fullName}? Motivo (opcional):`, '');
+        if (reason === null) return;
+        try {
+            await api.post(`/api/management/users/${user.id}/terminate-session`, { reason });
+            alert('Sessão terminada com sucesso.');
+        } catch (error) {
+            alert(error.response?.data?.error || 'Falha ao terminar a sessão.');
+        }
+    };
+
     return (
         <div className="app-container admin-container">
             <header className="admin-header">
@@ -234,9 +246,9 @@ function AdminPage() {
                 <h2>Utilizadores Online ({onlineUsers.length})</h2>
                 <div className="table-container">
                      <table className="admin-table">
-                        <thead><tr><th>Nome Completo</th><th>Utilizador</th><th>Papel</th><th>Setor</th><th>ONLINE</th></tr></thead>
+                        <thead><tr><th>Nome Completo</th><th>Utilizador</th><th>Papel</th><th>Setor</th><th>Página / Posto</th><th>Dispositivos</th><th>Última Ação</th><th>ONLINE</th>{hasPermission('TERMINATE_SESSIONS') && <th>Ações</th>}</tr></thead>
                         <tbody>
-                            {onlineUsers.map((user, index) => (<tr key={`online-${user.id}-${index}`}><td>{user.fullName.toUpperCase()}</td><td>{user.username.toUpperCase()}</td><td>{user.role.toUpperCase()}</td><td>{user.sector.toUpperCase()}</td><td style={{ textAlign: 'center' }}>🟢</td></tr>))}
+                            {onlineUsers.map((user) => (<tr key={`online-${user.id}`}><td>{user.fullName.toUpperCase()}</td><td>{user.username.toUpperCase()}</td><td>{user.role.toUpperCase()}</td><td>{user.sector.toUpperCase()}</td><td>{[user.page, user.station].filter(Boolean).join(' / ') || '-'}</td><td title={(user.devices || []).map(device => `${device.ip} - ${device.userAgent} (desde ${new Date(device.connectedAt).toLocaleString('pt-BR')})`).join('\n')}>{(user.devices || []).length}</td><td>{user.lastActionAt ? new Date(user.lastActionAt).toLocaleString('pt-BR') : '-'}</td><td style={{ textAlign: 'center' }}>🟢</td>{hasPermission('TERMINATE_SESSIONS') && (<td>{user.username !== actingUser?.username && user.role !== 'admin' && (<button onClick={() => handleTerminateSession(user)} className="reset-btn">Terminar Sessão</button>)}</td>)}</tr>))}
                         </tbody>
                     </table>
                 </div>
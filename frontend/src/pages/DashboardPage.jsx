@@ -1,5 +1,5 @@
 // src/pages/DashboardPage.jsx
-import React, { useState, useEffect, useCallback, useMemo } from 'react';
+import React, { useState, useEffect, useCallback, useMemo, useRef } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
 import { useWebSocket } from '../context/WebSocketContext';
@@ -10,6 +10,9 @@ import ExitModal from '../components/ExitModal';
 import ChangePasswordModal from '../components/ChangePasswordModal';
 import MoveItemModal from '../components/MoveItemModal';
 
+// Intervalo de atualização dos dados pela API enquanto não há ligação em tempo real.
+const FALLBACK_REFRESH_MS = 15000;
+
 const formatDuration = (seconds) => {
     // ... (função inalterada) ...
     if (isNaN(seconds) || seconds < 0) return '00:00:00';
@@ -52,12 +55,8 @@ function DashboardPage() {
     const [fallbackAvgTimes, setFallbackAvgTimes] = useState({ RTS: 0.0, EHA: 0.0 }); // NOVO
 
     // --- API FALLBACK ATUALIZADA ---
-    const fetchDataApi = useCallback(async () => {
-        // ... (lógica de skip) ...
-		if (initialDataLoaded) {
-             console.log("fetchDataApi: Skipping, initial data already loaded.");
-             return;
-        }
+    // Busca a fila pela API; usada enquanto não há ligação em tempo real.
+    const refreshFallbackData = useCallback(async () => {
         console.log("fetchDataApi: Buscando dados via API...");
 
         try {
@@ -87,11 +86,22 @@ function DashboardPage() {
             setFallbackCounts({ RTS: 0, EHA: 0, SAL: 0 });
             setFallbackValues({ RTS: 0, EHA: 0, SAL: 0 });
             setFallbackAvgTimes({ RTS: 0.0, EHA: 0.0 }); // NOVO
+        }
+    }, [isGuest]);
+
+    const fetchDataApi = useCallback(async () => {
+        // ... (lógica de skip) ...
+		if (initialDataLoaded) {
+             console.log("fetchDataApi: Skipping, initial data already loaded.");
+             return;
+        }
+        try {
+            await refreshFallbackData();
         } finally {
              console.log("fetchDataApi: Marcando initialDataLoaded como true.");
             setInitialDataLoaded(true);
         }
-    }, [isGuest, initialDataLoaded]);
+    }, [initialDataLoaded, refreshFallbackData]);
 
     // ... (useEffect syncTime, fetchDataApi, syncedTime inalterados) ...
 	useEffect(() => {
@@ -111,7 +121,7 @@ function DashboardPage() {
     }, []);
 
      useEffect(() => {
-        if ((isConnected && !isGuest && wsQueue.length > 0 && !initialDataLoaded) ) {
+        if ((isConnected && wsQueue.length > 0 && !initialDataLoaded) ) {
              console.log("Dados iniciais recebidos via WebSocket.");
             setInitialDataLoaded(true);
         }
@@ -122,6 +132,22 @@ function DashboardPage() {
 
      }, [isConnected, isGuest, wsQueue, initialDataLoaded, fetchDataApi]); 
 
+    // Sem ligação em tempo real (por exemplo, enquanto o WebSocket volta a ligar), o painel
+    // atualiza os dados pela API logo que a ligação cai e depois periodicamente.
+    const wasConnectedRef = useRef(false);
+    useEffect(() => {
+        const wasConnected = wasConnectedRef.current;
+        wasConnectedRef.current = isConnected;
+        if (!initialDataLoaded || isConnected) {
+            return;
+        }
+        if (wasConnected) {
+            refreshFallbackData(); // Os dados do WebSocket foram limpos ao perder a ligação
+        }
+        const interval = setInterval(refreshFallbackData, FALLBACK_REFRESH_MS);
+        return () => clearInterval(interval);
+    }, [initialDataLoaded, isConnected, refreshFallbackData]);
+
     useEffect(() => { /* ... (inalterado) ... */
         const interval = setInterval(() => {
             setSyncedTime(new Date().getTime() + timeOffset);
@@ -130,7 +156,7 @@ function DashboardPage() {
     }, [timeOffset]);
 
     // --- SELEÇÃO DE DADOS ATUALIZADA ---
-    const useFallbackData = isGuest || !isConnected;
+    const useFallbackData = !isConnected;
     const currentQueue = useFallbackData ? fallbackQueue : wsQueue;
     const currentBacklog = useFallbackData ? fallbackBacklog : wsBacklog; // Contagem backlog
     const currentBacklogValue = useFallbackData ? fallbackBacklogValue : wsBacklogValue; // Soma backlog